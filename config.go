@@ -1,32 +1,175 @@
 package rmskubeconfig
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/michaeljsaenz/rmskubeconfig/internal/kubeconfig"
 	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
 )
 
+// RetryPolicy controls retries of failed RMS requests
+type RetryPolicy = kubeconfig.RetryPolicy
+
+// ClusterFilter selects the clusters a kubeconfig is generated for
+type ClusterFilter = kubeconfig.ClusterFilter
+
+// ClusterMatch matches a cluster by name glob, name regexp or ID
+type ClusterMatch = kubeconfig.ClusterMatch
+
+// RequestError describes a failed RMS request
+type RequestError = types.RequestError
+
+// Error codes carried by RequestError.Code
+const (
+	ErrRequestCode           = types.ErrRequestCode
+	ErrUnauthorizedCode      = types.ErrUnauthorizedCode
+	ErrForbiddenCode         = types.ErrForbiddenCode
+	ErrNotFoundCode          = types.ErrNotFoundCode
+	ErrTransportCode         = types.ErrTransportCode
+	ErrDecodeCode            = types.ErrDecodeCode
+	ErrInvalidKubeconfigCode = types.ErrInvalidKubeconfigCode
+	ErrWriteCode             = types.ErrWriteCode
+	ErrStatusCode            = types.ErrStatusCode
+	ErrLockedCode            = types.ErrLockedCode
+	ErrContextNotFoundCode   = types.ErrContextNotFoundCode
+	ErrCollisionCode         = types.ErrCollisionCode
+	ErrNameTemplateCode      = types.ErrNameTemplateCode
+)
+
+// Sentinel errors for use with errors.Is, matched by RequestError.Code
+var (
+	ErrRequest           = types.ErrRequest
+	ErrUnauthorized      = types.ErrUnauthorized
+	ErrForbidden         = types.ErrForbidden
+	ErrNotFound          = types.ErrNotFound
+	ErrTransport         = types.ErrTransport
+	ErrDecode            = types.ErrDecode
+	ErrInvalidKubeconfig = types.ErrInvalidKubeconfig
+	ErrWrite             = types.ErrWrite
+	ErrStatus            = types.ErrStatus
+	ErrLocked            = types.ErrLocked
+	ErrContextNotFound   = types.ErrContextNotFound
+	ErrCollision         = types.ErrCollision
+	ErrNameTemplate      = types.ErrNameTemplate
+)
+
+// GenerateError lists the clusters that failed during a run that continued on error
+type GenerateError = types.GenerateError
+
+// Backup identifies a timestamped copy of a replaced kubeconfig
+type Backup = types.Backup
+
+// CurrentContextMode selects how current-context of the written kubeconfig is chosen
+type CurrentContextMode = types.CurrentContextMode
+
+const (
+	CurrentContextDefault = types.CurrentContextDefault
+	CurrentContextNamed   = types.CurrentContextNamed
+	CurrentContextFirst   = types.CurrentContextFirst
+	CurrentContextKeep    = types.CurrentContextKeep
+)
+
+// SortKey selects the order of entries in the written kubeconfig
+type SortKey = types.SortKey
+
+const (
+	SortByContext   = types.SortByContext
+	SortByCluster   = types.SortByCluster
+	SortByClusterID = types.SortByClusterID
+	SortNone        = types.SortNone
+)
+
+// CollisionStrategy selects how entries of different clusters sharing a name are resolved
+type CollisionStrategy = types.CollisionStrategy
+
+const (
+	CollisionFail     = types.CollisionFail
+	CollisionSuffix   = types.CollisionSuffix
+	CollisionLastWins = types.CollisionLastWins
+)
+
+// Collision describes a cluster, user or context name used by more than one RMS cluster
+type Collision = types.Collision
+
+// KubeconfigDiff describes the changes a dry run would make to the output file
+type KubeconfigDiff = types.KubeconfigDiff
+
+// EntryDiff describes a cluster, user or context that differs from the output file
+type EntryDiff = types.EntryDiff
+
+// FieldChange is a differing field of a kubeconfig entry, secrets are redacted
+type FieldChange = types.FieldChange
+
+// DiffAction describes how a kubeconfig entry differs from the output file
+type DiffAction = types.DiffAction
+
+const (
+	DiffAdded   = types.DiffAdded
+	DiffRemoved = types.DiffRemoved
+	DiffChanged = types.DiffChanged
+)
+
+// NameTemplateData is the data a name template set with SetNameTemplate is executed with
+type NameTemplateData = types.NameTemplateData
+
+// PrunedEntry identifies a kubeconfig entry removed by Prune
+type PrunedEntry = types.PrunedEntry
+
 // Config holds values for processing
 type Config struct {
-	rmsUrl     string
-	apiToken   string
-	outputPath string
-	clusterID  string
-	clusters   []types.RMSCluster
+	rmsUrl             string
+	apiToken           string
+	outputPath         string
+	outputFile         string
+	outputFromEnv      bool
+	createParentDirs   bool
+	clusterID          string
+	clusterFilter      ClusterFilter
+	pageLimit          int
+	concurrency        int
+	timeout            time.Duration
+	requestTimeout     time.Duration
+	retryPolicy        RetryPolicy
+	continueOnError    bool
+	allowEmpty         bool
+	merge              bool
+	dryRun             bool
+	currentContext     CurrentContextMode
+	currentContextName string
+	sortKey            SortKey
+	collisions         CollisionStrategy
+	nameTemplate       *template.Template
+	nameTemplateText   string
+	lockTimeout        time.Duration
+	backups            int
+	fileMode           os.FileMode
+	strictPermissions  bool
+	clusters           []types.RMSCluster
+	filteredOut        []types.RMSCluster
 }
 
 // NewConfig creates a new Config instance with default values
 func NewConfig() *Config {
 	return &Config{
-		rmsUrl:     "",
-		apiToken:   "",
-		outputPath: "",
-		clusterID:  "",
-		clusters:   []types.RMSCluster{},
+		rmsUrl:         "",
+		apiToken:       "",
+		outputPath:     "",
+		clusterID:      "",
+		concurrency:    1,
+		requestTimeout: kubeconfig.DefaultRequestTimeout,
+		retryPolicy:    kubeconfig.DefaultRetryPolicy,
+		lockTimeout:    kubeconfig.DefaultLockTimeout,
+		backups:        kubeconfig.DefaultBackups,
+		clusters:       []types.RMSCluster{},
 	}
 }
 
@@ -62,10 +205,39 @@ func (c *Config) SetOutputPath(path string) error {
 	}
 
 	c.outputPath = path
+	c.outputFile = ""
+	c.outputFromEnv = false
 
 	return nil
 }
 
+// SetOutputFile sets the full path of the kubeconfig file to write, e.g. "~/.kube/rms-prod.yaml"
+// A leading ~ and $VAR or ${VAR} references are expanded, it takes precedence over SetOutputPath
+// A reference to an undefined variable is an error
+// Setting the file explicitly, even to the $KUBECONFIG entry, replaces it unless SetMerge is enabled
+func (c *Config) SetOutputFile(path string) error {
+	expanded, err := expandPath(path)
+	if err != nil {
+		return err
+	}
+	if expanded == "" {
+		return fmt.Errorf("output file cannot be empty: %q", path)
+	}
+	if fileInfo, err := os.Stat(expanded); err == nil && fileInfo.IsDir() {
+		return fmt.Errorf("output file must not be a directory: %s", expanded)
+	}
+
+	c.outputFile = expanded
+	c.outputFromEnv = false
+
+	return nil
+}
+
+// SetCreateParentDirs creates missing parent directories of the output file when running
+func (c *Config) SetCreateParentDirs(enabled bool) {
+	c.createParentDirs = enabled
+}
+
 // SetClusterID sets a specific cluster ID for scoped tokens
 // Use this when your RMS token is scoped to a specific cluster and cannot list all clusters
 func (c *Config) SetClusterID(clusterID string) error {
@@ -76,6 +248,190 @@ func (c *Config) SetClusterID(clusterID string) error {
 	return nil
 }
 
+// SetClusterFilter sets which of the clusters listed by RMS a kubeconfig is generated for
+// Filters run before any kubeconfig is generated, so no token is created for a filtered cluster
+// They don't apply to a cluster ID set with SetClusterID, invalid patterns are rejected here
+func (c *Config) SetClusterFilter(filter ClusterFilter) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	c.clusterFilter = filter
+	return nil
+}
+
+// SetPageLimit sets the number of clusters requested per page when listing clusters
+// A limit of zero uses the RMS default page size
+func (c *Config) SetPageLimit(limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("page limit cannot be negative: %d", limit)
+	}
+	c.pageLimit = limit
+	return nil
+}
+
+// SetConcurrency sets the number of kubeconfigs generated in parallel
+func (c *Config) SetConcurrency(n int) error {
+	if n < 1 {
+		return fmt.Errorf("concurrency must be at least 1: %d", n)
+	}
+	c.concurrency = n
+	return nil
+}
+
+// SetTimeout sets the overall time limit for a run, zero disables the limit
+func (c *Config) SetTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative: %v", timeout)
+	}
+	c.timeout = timeout
+	return nil
+}
+
+// SetRequestTimeout sets the time limit for each individual RMS request
+func (c *Config) SetRequestTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return fmt.Errorf("request timeout must be positive: %v", timeout)
+	}
+	c.requestTimeout = timeout
+	return nil
+}
+
+// SetRetryPolicy sets how failed RMS requests are retried
+// A MaxAttempts of 1 disables retries
+func (c *Config) SetRetryPolicy(policy RetryPolicy) error {
+	if policy.MaxAttempts < 1 {
+		return fmt.Errorf("retry max attempts must be at least 1: %d", policy.MaxAttempts)
+	}
+	if policy.BaseBackoff < 0 || policy.MaxBackoff < 0 {
+		return fmt.Errorf("retry backoff cannot be negative: base %v, max %v", policy.BaseBackoff, policy.MaxBackoff)
+	}
+	if policy.MaxBackoff > 0 && policy.MaxBackoff < policy.BaseBackoff {
+		return fmt.Errorf("retry max backoff %v is less than base backoff %v", policy.MaxBackoff, policy.BaseBackoff)
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be between 0 and 1: %v", policy.Jitter)
+	}
+	c.retryPolicy = policy
+	return nil
+}
+
+// SetContinueOnError keeps generating when a cluster fails instead of aborting the run
+// Clusters that succeeded are still written and Run returns an error listing each failed cluster
+func (c *Config) SetContinueOnError(enabled bool) {
+	c.continueOnError = enabled
+}
+
+// SetAllowEmpty allows a run that finds no clusters to overwrite an existing output file
+// By default such a run fails and leaves the existing file untouched
+func (c *Config) SetAllowEmpty(enabled bool) {
+	c.allowEmpty = enabled
+}
+
+// SetMerge merges generated entries into an existing output file instead of overwriting it
+// Only entries previously written by rmskubeconfig are replaced, everything else is kept as is
+func (c *Config) SetMerge(enabled bool) {
+	c.merge = enabled
+}
+
+// SetCurrentContext sets how current-context of the written kubeconfig is chosen, name is only used with CurrentContextNamed
+func (c *Config) SetCurrentContext(mode CurrentContextMode, name string) error {
+	switch mode {
+	case CurrentContextNamed:
+		if name == "" {
+			return fmt.Errorf("current-context name cannot be empty")
+		}
+	case CurrentContextDefault, CurrentContextFirst, CurrentContextKeep:
+		if name != "" {
+			return fmt.Errorf("current-context name %q is only used with %q", name, CurrentContextNamed)
+		}
+	default:
+		return fmt.Errorf("invalid current-context mode: %q", mode)
+	}
+	c.currentContext = mode
+	c.currentContextName = name
+	return nil
+}
+
+// SetSortKey sets the order of entries in the written kubeconfig, contexts are sorted by name by default
+// Clusters and users follow the contexts referencing them, SortNone keeps the order clusters are listed by RMS
+func (c *Config) SetSortKey(key SortKey) error {
+	switch key {
+	case SortByContext, SortByCluster, SortByClusterID, SortNone:
+	default:
+		return fmt.Errorf("invalid sort key: %q", key)
+	}
+	c.sortKey = key
+	return nil
+}
+
+// SetNameTemplate sets a text/template renaming the clusters, users and contexts written, an empty template keeps the RMS names
+func (c *Config) SetNameTemplate(text string) error {
+	if text == "" {
+		c.nameTemplate, c.nameTemplateText = nil, ""
+		return nil
+	}
+
+	tmpl, err := kubeconfig.ParseNameTemplate(text)
+	if err != nil {
+		return fmt.Errorf("invalid name template: %v", err)
+	}
+	c.nameTemplate, c.nameTemplateText = tmpl, text
+	return nil
+}
+
+// SetCollisionStrategy sets how names shared by several clusters are resolved, by default such a run fails
+func (c *Config) SetCollisionStrategy(strategy CollisionStrategy) error {
+	switch strategy {
+	case CollisionFail, CollisionSuffix, CollisionLastWins:
+	default:
+		return fmt.Errorf("invalid collision strategy: %q", strategy)
+	}
+	c.collisions = strategy
+	return nil
+}
+
+// SetDryRun builds the combined kubeconfig without writing it, RunWithResult reports the diff against the output file
+func (c *Config) SetDryRun(enabled bool) {
+	c.dryRun = enabled
+}
+
+// SetLockTimeout sets how long a run waits for another run writing the same output file
+func (c *Config) SetLockTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return fmt.Errorf("lock timeout must be positive: %v", timeout)
+	}
+	c.lockTimeout = timeout
+	return nil
+}
+
+// SetBackups sets how many timestamped backups of a replaced output file are kept, zero disables backups
+func (c *Config) SetBackups(n int) error {
+	if n < 0 {
+		return fmt.Errorf("backups cannot be negative: %d", n)
+	}
+	c.backups = n
+	return nil
+}
+
+// SetFileMode sets the permissions of the output file, by default a new file is created with 0600
+// and a replaced group- or world-readable file (e.g. 0644 written by earlier versions) is tightened to 0600,
+// an owner-only file or one merged into with SetMerge keeps its mode
+func (c *Config) SetFileMode(mode os.FileMode) error {
+	if mode&^os.ModePerm != 0 {
+		return fmt.Errorf("file mode may only contain permission bits: %v", mode)
+	}
+	if mode&0600 != 0600 {
+		return fmt.Errorf("file mode must allow the owner to read and write: %v", mode)
+	}
+	c.fileMode = mode
+	return nil
+}
+
+// SetStrictPermissions fails a run instead of warning when a group- or world-readable output file is merged into
+func (c *Config) SetStrictPermissions(enabled bool) {
+	c.strictPermissions = enabled
+}
+
 // RMSUrl returns RMS API URL
 func (c *Config) RMSUrl() string {
 	return c.rmsUrl
@@ -91,13 +447,204 @@ func (c *Config) OutputPath() string {
 	return c.outputPath
 }
 
+// OutputFile returns the full path of the kubeconfig file if set
+func (c *Config) OutputFile() string {
+	return c.outputFile
+}
+
+// CreateParentDirs returns whether missing parent directories of the output file are created
+func (c *Config) CreateParentDirs() bool {
+	return c.createParentDirs
+}
+
 // ClusterID returns the specific cluster ID if set
 func (c *Config) ClusterID() string {
 	return c.clusterID
 }
 
-// Run executes the Config to generate combined kubeconfig (config) file
-func (c *Config) Run() error {
+// ClusterFilter returns the filter selecting the clusters a kubeconfig is generated for
+func (c *Config) ClusterFilter() ClusterFilter {
+	return c.clusterFilter
+}
+
+// Clusters returns the clusters resolved by the last run
+func (c *Config) Clusters() []RMSCluster {
+	return c.clusters
+}
+
+// PageLimit returns the number of clusters requested per page
+func (c *Config) PageLimit() int {
+	return c.pageLimit
+}
+
+// Concurrency returns the number of kubeconfigs generated in parallel
+func (c *Config) Concurrency() int {
+	return c.concurrency
+}
+
+// Timeout returns the overall time limit for a run
+func (c *Config) Timeout() time.Duration {
+	return c.timeout
+}
+
+// RequestTimeout returns the time limit for each individual RMS request
+func (c *Config) RequestTimeout() time.Duration {
+	return c.requestTimeout
+}
+
+// RetryPolicy returns how failed RMS requests are retried
+func (c *Config) RetryPolicy() RetryPolicy {
+	return c.retryPolicy
+}
+
+// ContinueOnError returns whether a run continues past failed clusters
+func (c *Config) ContinueOnError() bool {
+	return c.continueOnError
+}
+
+// AllowEmpty returns whether an empty cluster list may overwrite an existing output file
+func (c *Config) AllowEmpty() bool {
+	return c.allowEmpty
+}
+
+// Merge returns whether generated entries are merged into an existing output file
+func (c *Config) Merge() bool {
+	return c.merge
+}
+
+// CurrentContext returns how current-context is chosen and the name used with CurrentContextNamed
+func (c *Config) CurrentContext() (CurrentContextMode, string) {
+	return c.currentContext, c.currentContextName
+}
+
+// SortKey returns the order of entries in the written kubeconfig
+func (c *Config) SortKey() SortKey {
+	return c.sortKey
+}
+
+// NameTemplate returns the template renaming kubeconfig entries, empty when names are kept
+func (c *Config) NameTemplate() string {
+	return c.nameTemplateText
+}
+
+// CollisionStrategy returns how names shared by several clusters are resolved
+func (c *Config) CollisionStrategy() CollisionStrategy {
+	return c.collisions
+}
+
+// DryRun returns whether runs only report the diff against the output file
+func (c *Config) DryRun() bool {
+	return c.dryRun
+}
+
+// LockTimeout returns how long a run waits for the output file lock
+func (c *Config) LockTimeout() time.Duration {
+	return c.lockTimeout
+}
+
+// Backups returns how many backups of a replaced output file are kept
+func (c *Config) Backups() int {
+	return c.backups
+}
+
+// FileMode returns the permissions set for the output file, zero when the default applies
+func (c *Config) FileMode() os.FileMode {
+	return c.fileMode
+}
+
+// StrictPermissions returns whether merging into a group- or world-readable output file fails the run
+func (c *Config) StrictPermissions() bool {
+	return c.strictPermissions
+}
+
+// String describes the Config with the API token secret redacted
+func (c Config) String() string {
+	return fmt.Sprintf("Config{rmsUrl: %s, apiToken: %s, outputPath: %s, clusterID: %s}",
+		c.rmsUrl, redactToken(c.apiToken), c.outputPath, c.clusterID)
+}
+
+// GoString describes the Config for %#v with the API token secret redacted
+func (c Config) GoString() string {
+	return fmt.Sprintf("rmskubeconfig.Config{rmsUrl: %q, apiToken: %q, outputPath: %q, clusterID: %q}",
+		c.rmsUrl, redactToken(c.apiToken), c.outputPath, c.clusterID)
+}
+
+// LogValue describes the Config for log/slog with the API token secret redacted
+func (c Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("rmsUrl", c.rmsUrl),
+		slog.String("apiToken", redactToken(c.apiToken)),
+		slog.String("outputPath", c.outputPath),
+		slog.String("clusterID", c.clusterID),
+	)
+}
+
+// redactToken keeps the access key of a "token-xxxxx:secret" API token so it can still be identified
+func redactToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	if accessKey, _, found := strings.Cut(token, ":"); found {
+		return accessKey + ":REDACTED"
+	}
+	return "REDACTED"
+}
+
+// options builds the request options shared by every RMS call made during a run
+func (c *Config) options() kubeconfig.Options {
+	fileName := ""
+	if c.outputFile != "" {
+		fileName = filepath.Base(c.outputFile)
+	}
+
+	return kubeconfig.Options{
+		HTTPClient:         &http.Client{},
+		PageLimit:          c.pageLimit,
+		Concurrency:        c.concurrency,
+		RequestTimeout:     c.requestTimeout,
+		Retry:              c.retryPolicy,
+		ContinueOnError:    c.continueOnError,
+		AllowEmpty:         c.allowEmpty,
+		Merge:              c.merge || c.outputFromEnv,
+		CurrentContext:     c.currentContext,
+		CurrentContextName: c.currentContextName,
+		Sort:               c.sortKey,
+		NameTemplate:       c.nameTemplate,
+		Collisions:         c.collisions,
+		DryRun:             c.dryRun,
+		FileName:           fileName,
+		LockTimeout:        c.lockTimeout,
+		Backups:            c.backups,
+		FileMode:           c.fileMode,
+		StrictPermissions:  c.strictPermissions,
+	}
+}
+
+// resolveOutputPath resolves where the kubeconfig is written and makes the output path absolute
+// Without an output file or path the first $KUBECONFIG entry is used, then the current working directory
+// A $KUBECONFIG entry is the user's own kubeconfig, it is always merged into so other entries are kept
+func (c *Config) resolveOutputPath() error {
+	if c.outputFile == "" && c.outputPath == "" {
+		for _, path := range filepath.SplitList(os.Getenv("KUBECONFIG")) {
+			if path != "" {
+				c.outputFile = path
+				c.outputFromEnv = true
+				break
+			}
+		}
+	}
+
+	if c.outputFile != "" {
+		absFile, err := filepath.Abs(c.outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to resolve absolute path: %s, error: %v", c.outputFile, err)
+		}
+
+		c.outputFile = absFile
+		c.outputPath = filepath.Dir(absFile)
+
+		return c.ensureOutputDir()
+	}
 
 	if c.outputPath == "" {
 		cwd, err := os.Getwd()
@@ -116,27 +663,204 @@ func (c *Config) Run() error {
 
 	c.outputPath = absPath
 
-	var clusterIDs []string
+	return nil
+}
+
+// ensureOutputDir checks the directory of the output file exists, creating it when enabled
+func (c *Config) ensureOutputDir() error {
+	fileInfo, err := os.Stat(c.outputPath)
+	if err == nil {
+		if !fileInfo.IsDir() {
+			return fmt.Errorf("parent of output file is not a directory: %s", c.outputPath)
+		}
+		return nil
+	}
+
+	if !os.IsNotExist(err) || !c.createParentDirs {
+		return fmt.Errorf("parent directory of output file must exist: %s", c.outputPath)
+	}
+
+	// the directory will hold bearer tokens, keep it private
+	if err := os.MkdirAll(c.outputPath, 0700); err != nil {
+		return fmt.Errorf("failed to create output directory: %s, error: %v", c.outputPath, err)
+	}
+
+	return nil
+}
+
+// expandPath expands a leading ~ to the home directory and $VAR or ${VAR} references in path
+// An undefined variable is an error rather than an empty string, which could move the file to another directory
+func expandPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to expand ~ in path: %s, error: %v", path, err)
+		}
+		path = home + path[1:]
+	}
+
+	var undefined []string
+	expanded := os.Expand(path, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			undefined = append(undefined, name)
+		}
+		return value
+	})
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("undefined environment variable in path: %s, variables: %s", path, strings.Join(undefined, ", "))
+	}
+
+	return expanded, nil
+}
+
+// Run executes the Config to generate combined kubeconfig (config) file
+func (c *Config) Run() error {
+	return c.RunContext(context.Background())
+}
+
+// RunContext executes the Config like Run, aborting outstanding RMS requests when ctx is done
+func (c *Config) RunContext(ctx context.Context) error {
+	_, err := c.RunWithResult(ctx)
+	return err
+}
+
+// RunWithResult executes the Config like RunContext and reports what the run did
+// The result is returned whenever kubeconfig generation was attempted, including alongside an error
+func (c *Config) RunWithResult(ctx context.Context) (*RunResult, error) {
+	start := time.Now()
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	if err := c.resolveOutputPath(); err != nil {
+		return nil, err
+	}
+
+	opts := c.options()
+
+	clusterIDs, err := c.resolveClusterIDs(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Clusters = c.clustersByID()
+
+	report, err := kubeconfig.GenerateCombinedKubeconfig(ctx, c.rmsUrl, c.apiToken, c.outputPath, clusterIDs, opts)
+	result := newRunResult(c.clusters, c.filteredOut, report, time.Since(start))
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// Generate builds the combined kubeconfig in memory and returns it without writing any file
+// Output settings (merge, dry run, file mode, backups) do not apply. With SetContinueOnError a kubeconfig
+// of the clusters that succeeded is returned along with a *GenerateError
+func (c *Config) Generate(ctx context.Context) (*Kubeconfig, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	opts := c.options()
+
+	clusterIDs, err := c.resolveClusterIDs(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Clusters = c.clustersByID()
+
+	combined, _, err := kubeconfig.BuildCombinedKubeconfig(ctx, c.rmsUrl, c.apiToken, clusterIDs, opts)
+	return combined, err
+}
 
+// resolveClusterIDs returns the IDs of the clusters to generate, listing them from RMS unless a cluster ID is set
+func (c *Config) resolveClusterIDs(ctx context.Context, opts kubeconfig.Options) ([]string, error) {
 	// If a specific cluster ID is set, use it directly (for scoped tokens)
 	if c.clusterID != "" {
-		clusterIDs = []string{c.clusterID}
 		// Create a mock cluster entry for the specified ID
 		c.clusters = []types.RMSCluster{
 			{ID: c.clusterID, Name: fmt.Sprintf("cluster-%s", c.clusterID)},
 		}
-	} else {
-		// Use the existing behavior to get all clusters
-		clusters, _ := kubeconfig.GetClusters(c.rmsUrl, c.apiToken)
-		c.clusters = clusters
-		for _, cluster := range clusters {
-			clusterIDs = append(clusterIDs, cluster.ID)
-		}
+		c.filteredOut = nil
+		return []string{c.clusterID}, nil
 	}
 
-	err = kubeconfig.GenerateCombinedKubeconfig(c.rmsUrl, c.apiToken, c.outputPath, clusterIDs)
+	// Use the existing behavior to get all clusters
+	clusters, err := kubeconfig.GetClusters(ctx, c.rmsUrl, c.apiToken, opts)
 	if err != nil {
+		return nil, err
+	}
+
+	selected, err := kubeconfig.FilterClusters(clusters, c.clusterFilter)
+	if err != nil {
+		return nil, err
+	}
+	c.clusters = selected
+
+	// keep the clusters left out by the filter, a run reports them as skipped
+	selectedIDs := make(map[string]bool, len(selected))
+	for _, cluster := range selected {
+		selectedIDs[cluster.ID] = true
+	}
+	c.filteredOut = nil
+	for _, cluster := range clusters {
+		if !selectedIDs[cluster.ID] {
+			c.filteredOut = append(c.filteredOut, cluster)
+		}
+	}
+
+	var clusterIDs []string
+	for _, cluster := range selected {
+		clusterIDs = append(clusterIDs, cluster.ID)
+	}
+	return clusterIDs, nil
+}
+
+// clustersByID returns the clusters of the last run by ID
+func (c *Config) clustersByID() map[string]types.RMSCluster {
+	clusters := make(map[string]types.RMSCluster, len(c.clusters))
+	for _, cluster := range c.clusters {
+		clusters[cluster.ID] = cluster
+	}
+	return clusters
+}
+
+// Prune removes entries written by earlier runs whose cluster no longer exists in RMS from the output file
+// With dryRun the file is left untouched and the entries that would be removed are returned
+func (c *Config) Prune(ctx context.Context, dryRun bool) ([]PrunedEntry, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	if err := c.resolveOutputPath(); err != nil {
+		return nil, err
+	}
+
+	return kubeconfig.PruneKubeconfig(ctx, c.rmsUrl, c.apiToken, c.outputPath, dryRun, c.options())
+}
+
+// ListBackups returns the backups of the output file kept by earlier runs, newest first
+func (c *Config) ListBackups() ([]Backup, error) {
+	if err := c.resolveOutputPath(); err != nil {
+		return nil, err
+	}
+
+	return kubeconfig.ListBackups(c.outputPath, c.options())
+}
+
+// Restore rolls the output file back to a backup returned by ListBackups, given by file name or path
+// The content being replaced is backed up as well, so a restore can itself be undone
+func (c *Config) Restore(backup string) error {
+	if err := c.resolveOutputPath(); err != nil {
 		return err
 	}
-	return nil
+
+	return kubeconfig.RestoreBackup(c.outputPath, backup, c.options())
 }
@@ -1,12 +1,19 @@
 package rmskubeconfig
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/michaeljsaenz/rmskubeconfig/internal/kubeconfig"
 	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
@@ -220,6 +227,18 @@ contexts:
 }
 
 func TestRun_DefaultOutputPath(t *testing.T) {
+	t.Setenv("KUBECONFIG", "")
+
+	// the default output path is the working directory, keep the kubeconfig and lock sidecar out of the repo
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("failed to change working directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
 	// mock response data
 	expectedClusters := []types.RMSCluster{
 		{ID: "1", Name: "Cluster-1"},
@@ -262,7 +281,7 @@ contexts:
 
 	c.Run()
 
-	_, err := os.ReadFile(c.outputPath + "/config")
+	_, err = os.ReadFile(c.outputPath + "/config")
 	if err != nil {
 		t.Errorf("failed to read combined kubeconfig config file, error: %v", err)
 	}
@@ -417,3 +436,744 @@ func TestClusterID(t *testing.T) {
 		t.Errorf("ClusterID() expected %q; got %q", expectedClusterID, actualClusterID)
 	}
 }
+
+func TestSetPageLimit_ValidInput(t *testing.T) {
+	c := NewConfig()
+
+	err := c.SetPageLimit(50)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if c.PageLimit() != 50 {
+		t.Errorf("expected page limit to be 50, got %d", c.PageLimit())
+	}
+}
+
+func TestSetPageLimit_NegativeInput(t *testing.T) {
+	c := NewConfig()
+
+	err := c.SetPageLimit(-1)
+	if err == nil {
+		t.Errorf("expected error for negative page limit, but got none")
+	}
+	if c.pageLimit != 0 {
+		t.Errorf("expected page limit to remain 0, got %d", c.pageLimit)
+	}
+}
+
+func TestSetConcurrency_ValidInput(t *testing.T) {
+	c := NewConfig()
+
+	err := c.SetConcurrency(8)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if c.Concurrency() != 8 {
+		t.Errorf("expected concurrency to be 8, got %d", c.Concurrency())
+	}
+}
+
+func TestSetConcurrency_InvalidInput(t *testing.T) {
+	c := NewConfig()
+
+	err := c.SetConcurrency(0)
+	if err == nil {
+		t.Errorf("expected error for zero concurrency, but got none")
+	}
+	if c.concurrency != 1 {
+		t.Errorf("expected concurrency to remain 1, got %d", c.concurrency)
+	}
+}
+
+func TestSetTimeout(t *testing.T) {
+	c := NewConfig()
+
+	if err := c.SetTimeout(time.Minute); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if c.Timeout() != time.Minute {
+		t.Errorf("expected timeout to be %v, got %v", time.Minute, c.Timeout())
+	}
+
+	if err := c.SetTimeout(-time.Second); err == nil {
+		t.Errorf("expected error for negative timeout, but got none")
+	}
+}
+
+func TestSetRequestTimeout(t *testing.T) {
+	c := NewConfig()
+
+	if c.RequestTimeout() != kubeconfig.DefaultRequestTimeout {
+		t.Errorf("expected default request timeout %v, got %v", kubeconfig.DefaultRequestTimeout, c.RequestTimeout())
+	}
+
+	if err := c.SetRequestTimeout(5 * time.Second); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if c.RequestTimeout() != 5*time.Second {
+		t.Errorf("expected request timeout to be %v, got %v", 5*time.Second, c.RequestTimeout())
+	}
+
+	if err := c.SetRequestTimeout(0); err == nil {
+		t.Errorf("expected error for zero request timeout, but got none")
+	}
+}
+
+func TestRunContext_Timeout(t *testing.T) {
+	release := make(chan struct{})
+
+	// mock rms-api server that never answers
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer mockServer.Close()
+	defer close(release)
+
+	c := &Config{
+		rmsUrl:     mockServer.URL,
+		apiToken:   "token-test:test",
+		outputPath: t.TempDir(),
+		timeout:    50 * time.Millisecond,
+	}
+
+	err := c.RunContext(context.Background())
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+}
+
+func TestSetRetryPolicy(t *testing.T) {
+	c := NewConfig()
+
+	if c.RetryPolicy() != kubeconfig.DefaultRetryPolicy {
+		t.Errorf("expected default retry policy %+v, got %+v", kubeconfig.DefaultRetryPolicy, c.RetryPolicy())
+	}
+
+	policy := RetryPolicy{MaxAttempts: 5, BaseBackoff: time.Second, MaxBackoff: time.Minute, Jitter: 0.1}
+	if err := c.SetRetryPolicy(policy); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if c.RetryPolicy() != policy {
+		t.Errorf("expected retry policy %+v, got %+v", policy, c.RetryPolicy())
+	}
+
+	invalid := []RetryPolicy{
+		{MaxAttempts: 0},
+		{MaxAttempts: 2, BaseBackoff: -time.Second},
+		{MaxAttempts: 2, BaseBackoff: time.Minute, MaxBackoff: time.Second},
+		{MaxAttempts: 2, Jitter: 1.5},
+	}
+	for _, p := range invalid {
+		if err := c.SetRetryPolicy(p); err == nil {
+			t.Errorf("expected error for retry policy %+v, but got none", p)
+		}
+	}
+}
+
+func TestSetContinueOnError(t *testing.T) {
+	c := NewConfig()
+
+	if c.ContinueOnError() {
+		t.Errorf("expected continue on error to be disabled by default")
+	}
+
+	c.SetContinueOnError(true)
+	if !c.ContinueOnError() {
+		t.Errorf("expected continue on error to be enabled")
+	}
+}
+
+func TestRun_GetClustersError(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer mockServer.Close()
+
+	c := &Config{
+		rmsUrl:     mockServer.URL,
+		apiToken:   "token-test:test",
+		outputPath: t.TempDir(),
+	}
+
+	err := c.Run()
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+
+	var reqErr *RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("expected RequestError, but got: %T", err)
+	}
+	if reqErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, reqErr.StatusCode)
+	}
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected errors.Is to match ErrUnauthorized, got: %v", err)
+	}
+
+	if _, err := os.Stat(c.outputPath + "/config"); !os.IsNotExist(err) {
+		t.Errorf("expected no config file to be written, stat error: %v", err)
+	}
+}
+
+func TestRun_EmptyClusterListKeepsExistingOutput(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.RMSClusterResponse{Data: []types.RMSCluster{}})
+	}))
+	defer mockServer.Close()
+
+	outputPath := t.TempDir()
+	existing := []byte("existing kubeconfig")
+	if err := os.WriteFile(outputPath+"/config", existing, 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	c := &Config{
+		rmsUrl:     mockServer.URL,
+		apiToken:   "token-test:test",
+		outputPath: outputPath,
+	}
+
+	if err := c.Run(); err == nil {
+		t.Fatalf("expected error for empty cluster list, but got nil")
+	}
+
+	data, _ := os.ReadFile(outputPath + "/config")
+	if string(data) != string(existing) {
+		t.Errorf("expected existing config to be untouched, got %q", data)
+	}
+
+	c.SetAllowEmpty(true)
+	if err := c.Run(); err != nil {
+		t.Fatalf("unexpected error with empty output allowed: %v", err)
+	}
+
+	data, _ = os.ReadFile(outputPath + "/config")
+	if string(data) == string(existing) {
+		t.Errorf("expected existing config to be overwritten when empty output is allowed")
+	}
+}
+
+func TestSetFileMode(t *testing.T) {
+	config := NewConfig()
+
+	if config.FileMode() != 0 {
+		t.Errorf("expected default file mode 0, got %v", config.FileMode())
+	}
+
+	if err := config.SetFileMode(0640); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if config.FileMode() != 0640 {
+		t.Errorf("expected file mode 0640, got %v", config.FileMode())
+	}
+
+	for _, mode := range []os.FileMode{0400, 0044, os.ModeDir | 0600} {
+		if err := config.SetFileMode(mode); err == nil {
+			t.Errorf("expected error for file mode %v, but got nil", mode)
+		}
+	}
+}
+
+func TestConfig_RedactsApiToken(t *testing.T) {
+	config := NewConfig()
+	config.SetRMSUrl("https://rms.test")
+	config.SetApiToken("token-abcde:supersecretvalue")
+
+	var logs strings.Builder
+	slog.New(slog.NewJSONHandler(&logs, nil)).Info("run", "config", config)
+
+	outputs := []string{
+		fmt.Sprintf("%v", config),
+		fmt.Sprintf("%+v", config),
+		fmt.Sprintf("%#v", config),
+		fmt.Sprintf("%v", *config),
+		fmt.Sprintf("%+v", *config),
+		fmt.Sprintf("%#v", *config),
+		logs.String(),
+	}
+
+	for _, output := range outputs {
+		if strings.Contains(output, "supersecretvalue") {
+			t.Errorf("expected API token secret to be redacted, got %q", output)
+		}
+		if !strings.Contains(output, "token-abcde:REDACTED") {
+			t.Errorf("expected redacted access key in output, got %q", output)
+		}
+	}
+}
+
+func TestSetOutputFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("RMS_ENV", "prod")
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"~/.kube/rms-prod.yaml", home + "/.kube/rms-prod.yaml"},
+		{"$HOME/.kube/rms-${RMS_ENV}.yaml", home + "/.kube/rms-prod.yaml"},
+		{"/tmp/rms-dev.yaml", "/tmp/rms-dev.yaml"},
+		{"~other/config", "~other/config"},
+	}
+
+	for _, test := range tests {
+		config := NewConfig()
+		if err := config.SetOutputFile(test.path); err != nil {
+			t.Fatalf("SetOutputFile(%q) expected no error, but got: %v", test.path, err)
+		}
+		if config.OutputFile() != test.expected {
+			t.Errorf("SetOutputFile(%q) expected %q, got %q", test.path, test.expected, config.OutputFile())
+		}
+	}
+
+	config := NewConfig()
+	if err := config.SetOutputFile(""); err == nil {
+		t.Errorf("expected error for empty output file, but got nil")
+	}
+	if err := config.SetOutputFile(home); err == nil {
+		t.Errorf("expected error for a directory output file, but got nil")
+	}
+	if err := config.SetOutputFile("$KUBE_DIR_NOT_SET/rms.yaml"); err == nil {
+		t.Errorf("expected error for an undefined variable, but got nil")
+	}
+}
+
+func TestRun_OutputFile(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Query().Get("action") == kubeconfig.GenerateKubeconfigUrlAction {
+			json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: "clusters:\n- name: cluster1\n  cluster:\n    server: https://cluster1.test"})
+			return
+		}
+		json.NewEncoder(w).Encode(types.RMSClusterResponse{Data: []types.RMSCluster{{ID: "1", Name: "Cluster-1"}}})
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	outputFile := tempDir + "/nested/kube/rms-prod.yaml"
+
+	c := NewConfig()
+	c.rmsUrl = mockServer.URL
+	c.apiToken = "token-test:test"
+	if err := c.SetOutputFile(outputFile); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if err := c.Run(); err == nil {
+		t.Fatalf("expected error for missing parent directory, but got nil")
+	}
+
+	c.SetCreateParentDirs(true)
+	result, err := c.RunWithResult(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if result.OutputFile != outputFile {
+		t.Errorf("expected output file %s, got %s", outputFile, result.OutputFile)
+	}
+	if _, err := os.Stat(outputFile); err != nil {
+		t.Errorf("expected %s to be written, error: %v", outputFile, err)
+	}
+	info, err := os.Stat(tempDir + "/nested")
+	if err != nil {
+		t.Fatalf("failed to stat created directory: %v", err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("expected created directories to be private, got %v", info.Mode().Perm())
+	}
+}
+
+func TestRun_KubeconfigEnv(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.RMSClusterResponse{Data: []types.RMSCluster{}})
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	first, second := tempDir+"/rms.yaml", tempDir+"/other.yaml"
+	t.Setenv("KUBECONFIG", first+string(os.PathListSeparator)+second)
+
+	existing := "apiVersion: v1\nkind: Config\ncurrent-context: kind-dev\nclusters:\n- name: kind-dev\n  cluster:\n    server: https://127.0.0.1:6443\ncontexts:\n- name: kind-dev\n  context:\n    cluster: kind-dev\n"
+	if err := os.WriteFile(first, []byte(existing), 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	c := &Config{
+		rmsUrl:   mockServer.URL,
+		apiToken: "token-test:test",
+	}
+
+	if err := c.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if c.OutputFile() != first {
+		t.Errorf("expected the first $KUBECONFIG entry %s, got %s", first, c.OutputFile())
+	}
+	if _, err := os.Stat(first); err != nil {
+		t.Errorf("expected %s to be written, error: %v", first, err)
+	}
+	if _, err := os.Stat(second); err == nil {
+		t.Errorf("expected %s not to be written", second)
+	}
+
+	// the user's own kubeconfig is merged into, never replaced
+	data, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", first, err)
+	}
+	if !strings.Contains(string(data), "kind-dev") {
+		t.Errorf("expected the kind-dev entries of %s to be kept, got:\n%s", first, data)
+	}
+	if c.Merge() {
+		t.Errorf("expected merging into $KUBECONFIG not to change the merge setting")
+	}
+}
+
+func TestSetBackups(t *testing.T) {
+	config := NewConfig()
+
+	if config.Backups() != kubeconfig.DefaultBackups {
+		t.Errorf("expected default backups %d, got %d", kubeconfig.DefaultBackups, config.Backups())
+	}
+
+	if err := config.SetBackups(0); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if config.Backups() != 0 {
+		t.Errorf("expected backups 0, got %d", config.Backups())
+	}
+
+	if err := config.SetBackups(-1); err == nil {
+		t.Errorf("expected error for negative backups, but got nil")
+	}
+}
+
+func TestRunWithResult_DryRun(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Query().Get("action") == kubeconfig.GenerateKubeconfigUrlAction {
+			json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: "clusters:\n- name: cluster1\n  cluster:\n    server: https://cluster1.test"})
+			return
+		}
+		json.NewEncoder(w).Encode(types.RMSClusterResponse{Data: []types.RMSCluster{{ID: "1", Name: "Cluster-1"}}})
+	}))
+	defer mockServer.Close()
+
+	outputPath := t.TempDir()
+	c := &Config{
+		rmsUrl:     mockServer.URL,
+		apiToken:   "token-test:test",
+		outputPath: outputPath,
+	}
+	c.SetDryRun(true)
+
+	result, err := c.RunWithResult(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if _, err := os.Stat(outputPath + "/config"); err == nil {
+		t.Errorf("expected dry run not to write the output file")
+	}
+	if result.Diff == nil || len(result.Diff.Entries) != 1 || result.Diff.Entries[0].Action != DiffAdded {
+		t.Errorf("expected the new cluster in the diff, got %+v", result.Diff)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Query().Get("action") == kubeconfig.GenerateKubeconfigUrlAction {
+			json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: "clusters:\n- name: cluster1\n  cluster:\n    server: https://cluster1.test"})
+			return
+		}
+		json.NewEncoder(w).Encode(types.RMSClusterResponse{Data: []types.RMSCluster{{ID: "1", Name: "Cluster-1"}}})
+	}))
+	defer mockServer.Close()
+
+	outputPath := t.TempDir()
+	c := &Config{
+		rmsUrl:     mockServer.URL,
+		apiToken:   "token-test:test",
+		outputPath: outputPath,
+	}
+
+	generated, err := c.Generate(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	var cluster KubeconfigCluster = generated.Clusters[0]
+	if cluster.Cluster.Server != "https://cluster1.test" {
+		t.Errorf("expected server https://cluster1.test, got %s", cluster.Cluster.Server)
+	}
+	if entries, _ := os.ReadDir(outputPath); len(entries) != 0 {
+		t.Errorf("expected Generate not to write any file, found %d entries", len(entries))
+	}
+	if len(c.Clusters()) != 1 {
+		t.Errorf("expected resolved clusters to be recorded, got %v", c.Clusters())
+	}
+}
+
+func TestSetLockTimeout(t *testing.T) {
+	config := NewConfig()
+
+	if config.LockTimeout() != kubeconfig.DefaultLockTimeout {
+		t.Errorf("expected default lock timeout %v, got %v", kubeconfig.DefaultLockTimeout, config.LockTimeout())
+	}
+
+	if err := config.SetLockTimeout(5 * time.Second); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if config.LockTimeout() != 5*time.Second {
+		t.Errorf("expected lock timeout 5s, got %v", config.LockTimeout())
+	}
+
+	if err := config.SetLockTimeout(0); err == nil {
+		t.Errorf("expected error for zero lock timeout, but got nil")
+	}
+}
+
+func TestSetCurrentContext(t *testing.T) {
+	config := NewConfig()
+
+	if mode, name := config.CurrentContext(); mode != CurrentContextDefault || name != "" {
+		t.Errorf("expected default current-context mode, got %q %q", mode, name)
+	}
+
+	if err := config.SetCurrentContext(CurrentContextNamed, "prod"); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if mode, name := config.CurrentContext(); mode != CurrentContextNamed || name != "prod" {
+		t.Errorf("expected named prod, got %q %q", mode, name)
+	}
+
+	invalid := []struct {
+		mode CurrentContextMode
+		name string
+	}{
+		{CurrentContextNamed, ""},
+		{CurrentContextFirst, "prod"},
+		{"latest", ""},
+	}
+	for _, test := range invalid {
+		if err := config.SetCurrentContext(test.mode, test.name); err == nil {
+			t.Errorf("SetCurrentContext(%q, %q) expected error, but got nil", test.mode, test.name)
+		}
+	}
+}
+
+func TestSetSortKey(t *testing.T) {
+	config := NewConfig()
+
+	if key := config.SortKey(); key != SortByContext {
+		t.Errorf("expected contexts sorted by name by default, got %q", key)
+	}
+
+	for _, key := range []SortKey{SortByCluster, SortByClusterID, SortNone, SortByContext} {
+		if err := config.SetSortKey(key); err != nil {
+			t.Errorf("SetSortKey(%q) expected no error, but got: %v", key, err)
+		}
+		if got := config.SortKey(); got != key {
+			t.Errorf("expected sort key %q, got %q", key, got)
+		}
+	}
+
+	if err := config.SetSortKey("random"); err == nil {
+		t.Errorf("expected error for invalid sort key, but got nil")
+	}
+}
+
+func TestRunWithResult_Collisions(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Query().Get("action") == kubeconfig.GenerateKubeconfigUrlAction {
+			json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: "clusters:\n- name: cluster1\n  cluster:\n    server: https://cluster1.test"})
+			return
+		}
+		json.NewEncoder(w).Encode(types.RMSClusterResponse{Data: []types.RMSCluster{{ID: "1", Name: "Cluster-1"}, {ID: "2", Name: "Cluster-2"}}})
+	}))
+	defer mockServer.Close()
+
+	c := &Config{
+		rmsUrl:     mockServer.URL,
+		apiToken:   "token-test:test",
+		outputPath: t.TempDir(),
+	}
+
+	if _, err := c.RunWithResult(context.Background()); !errors.Is(err, ErrCollision) {
+		t.Fatalf("expected ErrCollision by default, but got: %v", err)
+	}
+
+	if err := c.SetCollisionStrategy(CollisionSuffix); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	result, err := c.RunWithResult(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if len(result.Collisions) != 1 || result.Collisions[0].Renamed["2"] != "cluster1-2" {
+		t.Errorf("expected cluster1 to be suffixed with the cluster ID, got %+v", result.Collisions)
+	}
+
+	if err := c.SetCollisionStrategy("first-wins"); err == nil {
+		t.Errorf("expected error for invalid collision strategy, but got nil")
+	}
+}
+
+func TestSetNameTemplate(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Query().Get("action") == kubeconfig.GenerateKubeconfigUrlAction {
+			json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: "clusters:\n- name: cluster1\n  cluster:\n    server: https://cluster1.test"})
+			return
+		}
+		json.NewEncoder(w).Encode(types.RMSClusterResponse{Data: []types.RMSCluster{{ID: "1", Name: "Cluster-1", Labels: map[string]string{"env": "prod"}}}})
+	}))
+	defer mockServer.Close()
+
+	c := &Config{rmsUrl: mockServer.URL, apiToken: "token-test:test"}
+
+	if err := c.SetNameTemplate("rms-{{.Env}}-{{.ClusterName}}"); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if err := c.SetNameTemplate("rms-{{.Environment}}"); err == nil {
+		t.Errorf("expected error for unknown template field, but got nil")
+	}
+	if c.NameTemplate() != "rms-{{.Env}}-{{.ClusterName}}" {
+		t.Errorf("expected invalid template to keep the previous one, got %q", c.NameTemplate())
+	}
+
+	combined, err := c.Generate(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if len(combined.Clusters) != 1 || combined.Clusters[0].Name != "rms-prod-Cluster-1" {
+		t.Errorf("expected cluster named from labels and RMS name, got %+v", combined.Clusters)
+	}
+
+	if err := c.SetNameTemplate(""); err != nil || c.NameTemplate() != "" {
+		t.Errorf("expected empty template to clear naming, got %q, %v", c.NameTemplate(), err)
+	}
+}
+
+func TestRun_ClusterFilter(t *testing.T) {
+	var mu sync.Mutex
+	var generated []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Query().Get("action") == kubeconfig.GenerateKubeconfigUrlAction {
+			clusterID := strings.TrimPrefix(r.URL.Path, kubeconfig.ClusterListPath)
+			mu.Lock()
+			generated = append(generated, clusterID)
+			mu.Unlock()
+			json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: fmt.Sprintf("clusters:\n- name: %s\n  cluster:\n    server: https://%s.test", clusterID, clusterID)})
+			return
+		}
+		json.NewEncoder(w).Encode(types.RMSClusterResponse{Data: []types.RMSCluster{
+			{ID: "local", Name: "local"},
+			{ID: "c-1", Name: "prod-eu"},
+			{ID: "c-2", Name: "prod-us"},
+			{ID: "c-3", Name: "dev-eu"},
+		}})
+	}))
+	defer mockServer.Close()
+
+	c := &Config{
+		rmsUrl:     mockServer.URL,
+		apiToken:   "token-test:test",
+		outputPath: t.TempDir(),
+	}
+	err := c.SetClusterFilter(ClusterFilter{
+		Include:   ClusterMatch{Names: []string{"prod-*"}, IDs: []string{"local"}},
+		Exclude:   ClusterMatch{IDs: []string{"c-2"}},
+		SkipLocal: true,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	result, err := c.RunWithResult(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if !reflect.DeepEqual(generated, []string{"c-1"}) {
+		t.Errorf("expected a kubeconfig to be generated for c-1 only, got %v", generated)
+	}
+	if clusters := c.Clusters(); len(clusters) != 1 || clusters[0].ID != "c-1" {
+		t.Errorf("expected filtered clusters, got %+v", clusters)
+	}
+
+	var skipped []string
+	for _, cluster := range result.Skipped() {
+		skipped = append(skipped, cluster.ID)
+	}
+	if !reflect.DeepEqual(skipped, []string{"local", "c-2", "c-3"}) {
+		t.Errorf("expected the filtered-out clusters to be reported as skipped, got %v", skipped)
+	}
+	if included := result.Included(); len(included) != 1 || included[0].ID != "c-1" {
+		t.Errorf("expected c-1 to be included, got %+v", included)
+	}
+
+	if err := c.SetClusterFilter(ClusterFilter{Exclude: ClusterMatch{NameRegexps: []string{"["}}}); err == nil {
+		t.Errorf("expected error for invalid regexp, but got nil")
+	}
+}
+
+func TestRun_LabelSelector(t *testing.T) {
+	var mu sync.Mutex
+	var generated []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Query().Get("action") == kubeconfig.GenerateKubeconfigUrlAction {
+			clusterID := strings.TrimPrefix(r.URL.Path, kubeconfig.ClusterListPath)
+			mu.Lock()
+			generated = append(generated, clusterID)
+			mu.Unlock()
+			json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: fmt.Sprintf("clusters:\n- name: %s\n  cluster:\n    server: https://%s.test", clusterID, clusterID)})
+			return
+		}
+		// trimmed /v3/clusters response, labels and annotations are top-level fields of each cluster
+		fmt.Fprint(w, `{"data": [
+			{"id": "c-1", "name": "payments-prod", "labels": {"env": "prod", "team": "payments"}, "annotations": {"field.cattle.io/creatorId": "u-1"}},
+			{"id": "c-2", "name": "payments-old", "labels": {"env": "prod", "team": "payments", "deprecated": "true"}},
+			{"id": "c-3", "name": "search-stage", "labels": {"env": "stage", "team": "search"}}
+		]}`)
+	}))
+	defer mockServer.Close()
+
+	c := &Config{
+		rmsUrl:     mockServer.URL,
+		apiToken:   "token-test:test",
+		outputPath: t.TempDir(),
+	}
+	if err := c.SetClusterFilter(ClusterFilter{LabelSelector: "env in (prod,stage),team=payments,!deprecated"}); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if err := c.Run(); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if !reflect.DeepEqual(generated, []string{"c-1"}) {
+		t.Errorf("expected a kubeconfig to be generated for c-1 only, got %v", generated)
+	}
+	clusters := c.Clusters()
+	if len(clusters) != 1 || clusters[0].Labels["team"] != "payments" || clusters[0].Annotations["field.cattle.io/creatorId"] != "u-1" {
+		t.Errorf("expected labels and annotations to be decoded, got %+v", clusters)
+	}
+
+	if err := c.SetClusterFilter(ClusterFilter{LabelSelector: "env in prod"}); err == nil {
+		t.Errorf("expected error for invalid label selector, but got nil")
+	}
+}
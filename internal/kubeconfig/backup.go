@@ -0,0 +1,239 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// backupTimeFormat stamps backups with the time the output file was replaced, e.g. config.20261016T101500.bak
+const backupTimeFormat = "20060102T150405"
+
+const backupSuffix = ".bak"
+
+// timeNow is a hook over the clock so tests can control backup names
+var timeNow = time.Now
+
+// backupConfigFile copies the kubeconfig at configPath to a timestamped backup before it is replaced with data
+// Nothing is backed up when backups are disabled, the file does not exist yet or data would not change it
+// Backups beyond opts.Backups are removed, oldest first
+func backupConfigFile(configPath string, data []byte, opts Options) error {
+	if opts.Backups <= 0 {
+		return nil
+	}
+
+	existing, err := os.ReadFile(configPath)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && bytes.Equal(existing, data)) {
+		return nil
+	}
+	if err != nil {
+		return &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("error reading kubeconfig %s to back up, error: %v", configPath, err),
+			Err:     err,
+		}
+	}
+
+	// backups hold the same bearer tokens, keep them owner-only
+	backupPath := nextBackupPath(configPath, timeNow())
+	if err := writeFileAtomic(backupPath, existing, DefaultFileMode, false); err != nil {
+		return &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("error writing kubeconfig backup %s, error: %v", backupPath, err),
+			Err:     err,
+		}
+	}
+
+	backups, err := listBackups(configPath)
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups[min(opts.Backups, len(backups)):] {
+		if err := os.Remove(backup.Path); err != nil {
+			opts.Logger.Warn("failed to remove old kubeconfig backup", "path", backup.Path, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// nextBackupPath returns a new backup path for configPath at time t
+// Backups taken within the same second get an increasing -1, -2, ... sequence suffix so they stay ordered
+func nextBackupPath(configPath string, t time.Time) string {
+	stamp := t.Format(backupTimeFormat)
+
+	next := 0
+	if entries, err := os.ReadDir(filepath.Dir(configPath)); err == nil {
+		for _, entry := range entries {
+			taken, seq, ok := parseBackupName(filepath.Base(configPath), entry.Name())
+			if ok && taken.Format(backupTimeFormat) == stamp {
+				next = max(next, seq+1)
+			}
+		}
+	}
+
+	if next == 0 {
+		return configPath + "." + stamp + backupSuffix
+	}
+	return fmt.Sprintf("%s.%s-%d%s", configPath, stamp, next, backupSuffix)
+}
+
+// parseBackupName returns the time and sequence of name when it is a backup of the file configName
+func parseBackupName(configName, name string) (time.Time, int, bool) {
+	stamp, ok := strings.CutPrefix(name, configName+".")
+	if !ok {
+		return time.Time{}, 0, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, backupSuffix)
+	if !ok {
+		return time.Time{}, 0, false
+	}
+
+	seq := 0
+	if base, seqText, found := strings.Cut(stamp, "-"); found {
+		n, err := strconv.Atoi(seqText)
+		if err != nil || n < 1 {
+			return time.Time{}, 0, false
+		}
+		stamp, seq = base, n
+	}
+
+	t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	return t, seq, true
+}
+
+// listBackups returns the backups of configPath, newest first
+func listBackups(configPath string) ([]types.Backup, error) {
+	entries, err := os.ReadDir(filepath.Dir(configPath))
+	if err != nil {
+		return nil, &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("error listing kubeconfig backups of %s, error: %v", configPath, err),
+			Err:     err,
+		}
+	}
+
+	type sequenced struct {
+		backup types.Backup
+		seq    int
+	}
+
+	var found []sequenced
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		t, seq, ok := parseBackupName(filepath.Base(configPath), entry.Name())
+		if !ok {
+			continue
+		}
+		found = append(found, sequenced{
+			backup: types.Backup{Path: filepath.Join(filepath.Dir(configPath), entry.Name()), Time: t},
+			seq:    seq,
+		})
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].backup.Time.Equal(found[j].backup.Time) {
+			return found[i].backup.Time.After(found[j].backup.Time)
+		}
+		return found[i].seq > found[j].seq
+	})
+
+	backups := make([]types.Backup, len(found))
+	for i := range found {
+		backups[i] = found[i].backup
+	}
+	return backups, nil
+}
+
+// ListBackups returns the backups of the kubeconfig file (opts.FileName) in outputPath, newest first
+func ListBackups(outputPath string, opts Options) ([]types.Backup, error) {
+	opts = opts.withDefaults()
+	configPath, err := resolveConfigFile(opts.outputFile(outputPath))
+	if err != nil {
+		return nil, err
+	}
+	return listBackups(configPath)
+}
+
+// RestoreBackup replaces the kubeconfig file (opts.FileName) in outputPath with one of its backups
+// backup is the file name or path of a backup returned by ListBackups, the replaced content is itself backed up
+func RestoreBackup(outputPath, backup string, opts Options) error {
+	opts = opts.withDefaults()
+	configPath, err := resolveConfigFile(opts.outputFile(outputPath))
+	if err != nil {
+		return err
+	}
+
+	// backups are kept next to the resolved file
+	backupPath := backup
+	if filepath.Base(backup) == backup {
+		backupPath = filepath.Join(filepath.Dir(configPath), backup)
+	}
+
+	absBackup, err := filepath.Abs(backupPath)
+	if err != nil {
+		return &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("error resolving kubeconfig backup %s, error: %v", backup, err),
+			Err:     err,
+		}
+	}
+	absConfig, err := filepath.Abs(configPath)
+	if err != nil {
+		return &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("error resolving kubeconfig %s, error: %v", configPath, err),
+			Err:     err,
+		}
+	}
+	if _, _, ok := parseBackupName(filepath.Base(absConfig), filepath.Base(absBackup)); !ok || filepath.Dir(absBackup) != filepath.Dir(absConfig) {
+		return &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("%s is not a backup of %s", backup, configPath),
+		}
+	}
+
+	data, err := os.ReadFile(absBackup)
+	if err != nil {
+		return &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("error reading kubeconfig backup %s, error: %v", absBackup, err),
+			Err:     err,
+		}
+	}
+
+	// refuse to roll back to something kubectl could not load
+	var kubeconfig types.Kubeconfig
+	if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+		return &types.RequestError{
+			Code:    types.ErrInvalidKubeconfigCode,
+			Message: fmt.Sprintf("error unmarshaling kubeconfig backup %s, error: %v", absBackup, err),
+			Err:     err,
+		}
+	}
+
+	unlock, err := lockConfigFile(context.Background(), configPath, opts)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return writeConfigFile(configPath, data, opts.Merge, opts)
+}
@@ -0,0 +1,178 @@
+package kubeconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// fixedClock makes timeNow return t until the test ends
+func fixedClock(t *testing.T, now time.Time) {
+	t.Helper()
+	previous := timeNow
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = previous })
+}
+
+func writeBackupTestConfig(t *testing.T, dir, content string) {
+	t.Helper()
+	opts := Options{Backups: 2}.withDefaults()
+	if err := writeConfigFile(filepath.Join(dir, ConfigFileName), []byte(content), false, opts); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+}
+
+func TestWriteConfigFile_Backup(t *testing.T) {
+	tempDir := t.TempDir()
+	fixedClock(t, time.Date(2026, 10, 16, 10, 15, 0, 0, time.Local))
+
+	writeBackupTestConfig(t, tempDir, "apiVersion: v1\nkind: Config\n")
+	if backups, _ := ListBackups(tempDir, Options{}); len(backups) != 0 {
+		t.Fatalf("expected no backup of a new file, got %v", backups)
+	}
+
+	writeBackupTestConfig(t, tempDir, "apiVersion: v1\nkind: Config\ncurrent-context: a\n")
+	backups, err := ListBackups(tempDir, Options{})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if len(backups) != 1 || filepath.Base(backups[0].Path) != "config.20261016T101500.bak" {
+		t.Fatalf("expected config.20261016T101500.bak, got %v", backups)
+	}
+
+	data, _ := os.ReadFile(backups[0].Path)
+	if string(data) != "apiVersion: v1\nkind: Config\n" {
+		t.Errorf("expected backup of the previous content, got %q", data)
+	}
+	if info, _ := os.Stat(backups[0].Path); info.Mode().Perm() != DefaultFileMode {
+		t.Errorf("expected backup mode %v, got %v", DefaultFileMode, info.Mode().Perm())
+	}
+
+	// an unchanged file is not backed up again
+	writeBackupTestConfig(t, tempDir, "apiVersion: v1\nkind: Config\ncurrent-context: a\n")
+	if backups, _ := ListBackups(tempDir, Options{}); len(backups) != 1 {
+		t.Errorf("expected no backup of unchanged content, got %v", backups)
+	}
+}
+
+func TestWriteConfigFile_BackupRotation(t *testing.T) {
+	tempDir := t.TempDir()
+	fixedClock(t, time.Date(2026, 10, 16, 10, 15, 0, 0, time.Local))
+
+	for _, content := range []string{"kind: Config\n", "kind: Config\n# 1\n", "kind: Config\n# 2\n", "kind: Config\n# 3\n", "kind: Config\n# 4\n"} {
+		writeBackupTestConfig(t, tempDir, content)
+	}
+
+	backups, err := ListBackups(tempDir, Options{})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	// runs within the same second get a sequence suffix, only the newest two are kept
+	expected := []string{"config.20261016T101500-3.bak", "config.20261016T101500-2.bak"}
+	if len(backups) != len(expected) {
+		t.Fatalf("expected %d backups, got %v", len(expected), backups)
+	}
+	for i, name := range expected {
+		if filepath.Base(backups[i].Path) != name {
+			t.Errorf("expected backup %d to be %s, got %s", i, name, filepath.Base(backups[i].Path))
+		}
+	}
+
+	data, _ := os.ReadFile(backups[0].Path)
+	if string(data) != "kind: Config\n# 3\n" {
+		t.Errorf("expected newest backup to hold the previous content, got %q", data)
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	tempDir := t.TempDir()
+	fixedClock(t, time.Date(2026, 10, 16, 10, 15, 0, 0, time.Local))
+
+	writeBackupTestConfig(t, tempDir, "apiVersion: v1\nkind: Config\ncurrent-context: good\n")
+	writeBackupTestConfig(t, tempDir, "apiVersion: v1\nkind: Config\n")
+
+	if err := RestoreBackup(tempDir, "config.20261016T101500.bak", Options{Backups: 2}); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(tempDir, ConfigFileName))
+	if string(data) != "apiVersion: v1\nkind: Config\ncurrent-context: good\n" {
+		t.Errorf("expected backup content to be restored, got %q", data)
+	}
+
+	// the replaced content is backed up too, so the restore can be undone
+	backups, _ := ListBackups(tempDir, Options{})
+	if len(backups) != 2 {
+		t.Fatalf("expected the restore to add a backup, got %v", backups)
+	}
+	if data, _ := os.ReadFile(backups[0].Path); string(data) != "apiVersion: v1\nkind: Config\n" {
+		t.Errorf("expected the replaced content to be backed up, got %q", data)
+	}
+}
+
+func TestRestoreBackup_Rejected(t *testing.T) {
+	tempDir := t.TempDir()
+	otherDir := t.TempDir()
+
+	files := map[string]string{
+		filepath.Join(tempDir, "config.20261016T101500.bak"):  "clusters: [not, valid",
+		filepath.Join(tempDir, "other.20261016T101500.bak"):   "kind: Config\n",
+		filepath.Join(otherDir, "config.20261016T101500.bak"): "kind: Config\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	tests := []struct {
+		backup   string
+		expected error
+	}{
+		{"config.20261016T101500.bak", types.ErrInvalidKubeconfig},
+		{"other.20261016T101500.bak", types.ErrWrite},
+		{filepath.Join(otherDir, "config.20261016T101500.bak"), types.ErrWrite},
+		{"config.20261016T101501.bak", types.ErrWrite},
+	}
+
+	for _, test := range tests {
+		err := RestoreBackup(tempDir, test.backup, Options{})
+		if !errors.Is(err, test.expected) {
+			t.Errorf("RestoreBackup(%q) expected %v, but got: %v", test.backup, test.expected, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, ConfigFileName)); err == nil {
+		t.Errorf("expected no config to be written by a rejected restore")
+	}
+}
+
+func TestParseBackupName(t *testing.T) {
+	tests := []struct {
+		name string
+		seq  int
+		ok   bool
+	}{
+		{"config.20261016T101500.bak", 0, true},
+		{"config.20261016T101500-3.bak", 3, true},
+		{"config.20261016T101500-0.bak", 0, false},
+		{"config.20261016.bak", 0, false},
+		{"config.yaml.20261016T101500.bak", 0, false},
+		{"config", 0, false},
+	}
+
+	for _, test := range tests {
+		stamp, seq, ok := parseBackupName("config", test.name)
+		if ok != test.ok || seq != test.seq {
+			t.Errorf("parseBackupName(%q) expected (%d, %v), got (%d, %v)", test.name, test.seq, test.ok, seq, ok)
+		}
+		if ok && !stamp.Equal(time.Date(2026, 10, 16, 10, 15, 0, 0, time.Local)) {
+			t.Errorf("parseBackupName(%q) expected 2026-10-16 10:15:00, got %v", test.name, stamp)
+		}
+	}
+}
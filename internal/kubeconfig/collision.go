@@ -0,0 +1,379 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// collision is a types.Collision along with the indexes of the kubeconfigs sharing the name
+type collision struct {
+	types.Collision
+	owners []int
+}
+
+// collisionKinds lists how the entries of each kind are named, renamed and dropped
+// Contexts go first, so a context colliding along with its cluster and user is not reported as a dependent drop
+var collisionKinds = []struct {
+	kind    string
+	names   func(*types.Kubeconfig) []string
+	markers func(*types.Kubeconfig) map[string]types.ManagedMarker
+	rename  func(k *types.Kubeconfig, old, renamed string)
+	drop    func(k *types.Kubeconfig, name string) []string
+}{
+	{"context", contextEntryNames, contextMarkers, renameContext, dropContext},
+	{"cluster", clusterEntryNames, clusterMarkers, renameCluster, dropCluster},
+	{"user", userEntryNames, userMarkers, renameUser, dropUser},
+}
+
+// resolveCollisions finds cluster, user and context names used by more than one cluster and resolves them
+// in place as chosen by opts.Collisions, kubeconfigs are visited in order (the merge order)
+// With types.CollisionFail the collisions are returned along with an ErrCollisionCode error
+func resolveCollisions(clusterIDs []string, kubeconfigs []*types.Kubeconfig, order []int, opts Options) ([]types.Collision, error) {
+	var collisions []types.Collision
+	// index of the last collision that dropped entries of each losing kubeconfig
+	lastDrop := map[int]int{}
+	for _, kind := range collisionKinds {
+		for _, c := range findCollisions(kind.kind, clusterIDs, kubeconfigs, order, kind.names) {
+			c.Resolution = opts.Collisions
+
+			switch opts.Collisions {
+			case types.CollisionSuffix:
+				c.Renamed = make(map[string]string, len(c.owners))
+				for _, i := range c.owners {
+					c.Renamed[clusterIDs[i]] = c.Name + "-" + clusterIDs[i]
+					kind.rename(kubeconfigs[i], c.Name, c.Renamed[clusterIDs[i]])
+				}
+			case types.CollisionLastWins:
+				c.Winner = clusterIDs[c.owners[len(c.owners)-1]]
+				for _, i := range c.owners[:len(c.owners)-1] {
+					c.Dropped = append(c.Dropped, kind.drop(kubeconfigs[i], c.Name)...)
+					lastDrop[i] = len(collisions)
+				}
+				if len(c.Dropped) > 0 {
+					opts.Logger.Warn("dropped contexts of colliding "+kind.kind, "name", c.Name, "contexts", c.Dropped)
+				}
+			}
+
+			collisions = append(collisions, c.Collision)
+		}
+	}
+
+	// a losing kubeconfig may be left with a cluster, or a user and its token, that no context references
+	for _, i := range order {
+		at, ok := lastDrop[i]
+		if !ok {
+			continue
+		}
+		if users := dropUnreferenced(kubeconfigs[i], nil); len(users) > 0 {
+			collisions[at].Dropped = append(collisions[at].Dropped, users...)
+			opts.Logger.Warn("dropped users left without a context by a collision", "cluster", clusterIDs[i], "users", users)
+		}
+	}
+
+	if len(collisions) > 0 && opts.Collisions == types.CollisionFail {
+		return collisions, collisionError(collisions)
+	}
+
+	return collisions, nil
+}
+
+// resolveMergeCollisions finds names of generated entries used by managed entries of existing that an earlier
+// run wrote for another cluster of the same RMS, and resolves them in place as chosen by opts.Collisions
+// The entries of a cluster regenerated by this run are replaced by merging, so they never collide
+// The existing owner comes first in merge order, with types.CollisionLastWins the generated entry is kept
+func resolveMergeCollisions(existing, generated *types.Kubeconfig, opts Options) ([]types.Collision, error) {
+	regenerated := map[types.ManagedMarker]bool{}
+	for _, kind := range collisionKinds {
+		for _, marker := range kind.markers(generated) {
+			regenerated[marker] = true
+		}
+	}
+
+	var collisions []types.Collision
+	// index of the last collision that dropped entries of each losing owner
+	lastDrop := map[types.ManagedMarker]int{}
+	var losers []types.ManagedMarker
+	for _, kind := range collisionKinds {
+		generatedMarkers := kind.markers(generated)
+		existingMarkers := kind.markers(existing)
+
+		names := make([]string, 0, len(existingMarkers))
+		for name := range existingMarkers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			owner := existingMarkers[name]
+			generatedOwner, ok := generatedMarkers[name]
+			if !ok || generatedOwner.RMSUrl != owner.RMSUrl || generatedOwner.ClusterID == owner.ClusterID || regenerated[owner] {
+				continue
+			}
+
+			c := types.Collision{
+				Kind:       kind.kind,
+				Name:       name,
+				ClusterIDs: []string{owner.ClusterID, generatedOwner.ClusterID},
+				Resolution: opts.Collisions,
+			}
+
+			switch opts.Collisions {
+			case types.CollisionSuffix:
+				c.Renamed = map[string]string{
+					owner.ClusterID:          name + "-" + owner.ClusterID,
+					generatedOwner.ClusterID: name + "-" + generatedOwner.ClusterID,
+				}
+				kind.rename(existing, name, c.Renamed[owner.ClusterID])
+				kind.rename(generated, name, c.Renamed[generatedOwner.ClusterID])
+			case types.CollisionLastWins:
+				c.Winner = generatedOwner.ClusterID
+				c.Dropped = kind.drop(existing, name)
+				if len(c.Dropped) > 0 {
+					opts.Logger.Warn("dropped contexts of colliding "+kind.kind, "name", name, "contexts", c.Dropped)
+				}
+				if _, ok := lastDrop[owner]; !ok {
+					losers = append(losers, owner)
+				}
+				lastDrop[owner] = len(collisions)
+			}
+
+			collisions = append(collisions, c)
+		}
+	}
+
+	// as in resolveCollisions, drop the entries of a losing owner no context references any more
+	for _, owner := range losers {
+		users := dropUnreferenced(existing, func(extensions []types.KubeconfigExtension) bool {
+			marker, ok := managedMarker(extensions)
+			return ok && marker == owner
+		})
+		if len(users) > 0 {
+			at := lastDrop[owner]
+			collisions[at].Dropped = append(collisions[at].Dropped, users...)
+			opts.Logger.Warn("dropped users left without a context by a collision", "cluster", owner.ClusterID, "users", users)
+		}
+	}
+
+	if len(collisions) > 0 && opts.Collisions == types.CollisionFail {
+		return collisions, collisionError(collisions)
+	}
+
+	return collisions, nil
+}
+
+// collisionError describes collisions left unresolved with types.CollisionFail
+func collisionError(collisions []types.Collision) error {
+	descriptions := make([]string, len(collisions))
+	for i, c := range collisions {
+		descriptions[i] = fmt.Sprintf("%s %q (%s)", c.Kind, c.Name, strings.Join(c.ClusterIDs, ", "))
+	}
+	return &types.RequestError{
+		Code:    types.ErrCollisionCode,
+		Message: fmt.Sprintf("entries of different clusters share a name: %s", strings.Join(descriptions, "; ")),
+	}
+}
+
+// findCollisions returns the names used by more than one kubeconfig, ordered by name
+func findCollisions(kind string, clusterIDs []string, kubeconfigs []*types.Kubeconfig, order []int, names func(*types.Kubeconfig) []string) []collision {
+	owners := map[string][]int{}
+	for _, i := range order {
+		if kubeconfigs[i] == nil {
+			continue
+		}
+		for _, name := range names(kubeconfigs[i]) {
+			// a name repeated within one kubeconfig is not a collision between clusters
+			if ids := owners[name]; len(ids) > 0 && ids[len(ids)-1] == i {
+				continue
+			}
+			owners[name] = append(owners[name], i)
+		}
+	}
+
+	var collisions []collision
+	for name, indexes := range owners {
+		if len(indexes) < 2 {
+			continue
+		}
+		c := collision{Collision: types.Collision{Kind: kind, Name: name}, owners: indexes}
+		for _, i := range indexes {
+			c.ClusterIDs = append(c.ClusterIDs, clusterIDs[i])
+		}
+		collisions = append(collisions, c)
+	}
+	sort.Slice(collisions, func(a, b int) bool { return collisions[a].Name < collisions[b].Name })
+
+	return collisions
+}
+
+func clusterEntryNames(k *types.Kubeconfig) []string {
+	names := make([]string, len(k.Clusters))
+	for i, cluster := range k.Clusters {
+		names[i] = cluster.Name
+	}
+	return names
+}
+
+func userEntryNames(k *types.Kubeconfig) []string {
+	names := make([]string, len(k.Users))
+	for i, user := range k.Users {
+		names[i] = user.Name
+	}
+	return names
+}
+
+func contextEntryNames(k *types.Kubeconfig) []string {
+	names := make([]string, len(k.Contexts))
+	for i, kubeContext := range k.Contexts {
+		names[i] = kubeContext.Name
+	}
+	return names
+}
+
+// clusterMarkers returns the markers of the managed cluster entries of k by name
+func clusterMarkers(k *types.Kubeconfig) map[string]types.ManagedMarker {
+	markers := map[string]types.ManagedMarker{}
+	for _, cluster := range k.Clusters {
+		if marker, ok := managedMarker(cluster.Cluster.Extensions); ok {
+			markers[cluster.Name] = marker
+		}
+	}
+	return markers
+}
+
+// userMarkers returns the markers of the managed user entries of k by name
+func userMarkers(k *types.Kubeconfig) map[string]types.ManagedMarker {
+	markers := map[string]types.ManagedMarker{}
+	for _, user := range k.Users {
+		if marker, ok := managedMarker(user.User.Extensions); ok {
+			markers[user.Name] = marker
+		}
+	}
+	return markers
+}
+
+// contextMarkers returns the markers of the managed contexts of k by name
+func contextMarkers(k *types.Kubeconfig) map[string]types.ManagedMarker {
+	markers := map[string]types.ManagedMarker{}
+	for _, kubeContext := range k.Contexts {
+		if marker, ok := managedMarker(kubeContext.Context.Extensions); ok {
+			markers[kubeContext.Name] = marker
+		}
+	}
+	return markers
+}
+
+// renameCluster renames the cluster entry old of k to renamed and the contexts referencing it
+func renameCluster(k *types.Kubeconfig, old, renamed string) {
+	for i := range k.Clusters {
+		if k.Clusters[i].Name == old {
+			k.Clusters[i].Name = renamed
+		}
+	}
+	for i := range k.Contexts {
+		if k.Contexts[i].Context.Cluster == old {
+			k.Contexts[i].Context.Cluster = renamed
+		}
+	}
+}
+
+// renameUser renames the user entry old of k to renamed and the contexts referencing it
+func renameUser(k *types.Kubeconfig, old, renamed string) {
+	for i := range k.Users {
+		if k.Users[i].Name == old {
+			k.Users[i].Name = renamed
+		}
+	}
+	for i := range k.Contexts {
+		if k.Contexts[i].Context.User == old {
+			k.Contexts[i].Context.User = renamed
+		}
+	}
+}
+
+// renameContext renames the context old of k to renamed, following it with current-context
+func renameContext(k *types.Kubeconfig, old, renamed string) {
+	for i := range k.Contexts {
+		if k.Contexts[i].Name == old {
+			k.Contexts[i].Name = renamed
+		}
+	}
+	if k.CurrentContext == old {
+		k.CurrentContext = renamed
+	}
+}
+
+// dropCluster removes the cluster entry name of k along with the contexts referencing it, returning their names
+// Keeping such a context would pair it with the cluster of another RMS cluster
+func dropCluster(k *types.Kubeconfig, name string) []string {
+	k.Clusters = without(k.Clusters, func(c types.KubeconfigCluster) bool { return c.Name == name })
+	return dropContexts(k, func(c types.KubeconfigContext) bool { return c.Context.Cluster == name })
+}
+
+// dropUser removes the user entry name of k along with the contexts referencing it, returning their names
+// Keeping such a context would send the credentials of another RMS cluster
+func dropUser(k *types.Kubeconfig, name string) []string {
+	k.Users = without(k.Users, func(u types.KubeconfigUser) bool { return u.Name == name })
+	return dropContexts(k, func(c types.KubeconfigContext) bool { return c.Context.User == name })
+}
+
+// dropContext removes the context name of k, the context itself is not reported as a dependent drop
+func dropContext(k *types.Kubeconfig, name string) []string {
+	dropContexts(k, func(c types.KubeconfigContext) bool { return c.Name == name })
+	return nil
+}
+
+// dropUnreferenced removes the clusters and users of k no context references, only those matching owned
+// when it is set, and returns the names of the removed users
+func dropUnreferenced(k *types.Kubeconfig, owned func([]types.KubeconfigExtension) bool) []string {
+	clusters, users := map[string]bool{}, map[string]bool{}
+	for _, kubeContext := range k.Contexts {
+		clusters[kubeContext.Context.Cluster] = true
+		users[kubeContext.Context.User] = true
+	}
+
+	k.Clusters = without(k.Clusters, func(c types.KubeconfigCluster) bool {
+		return !clusters[c.Name] && (owned == nil || owned(c.Cluster.Extensions))
+	})
+
+	var dropped []string
+	k.Users = without(k.Users, func(u types.KubeconfigUser) bool {
+		drop := !users[u.Name] && (owned == nil || owned(u.User.Extensions))
+		if drop {
+			dropped = append(dropped, u.Name)
+		}
+		return drop
+	})
+	return dropped
+}
+
+// dropContexts removes the contexts of k matching drop, clearing current-context when it is removed
+func dropContexts(k *types.Kubeconfig, drop func(types.KubeconfigContext) bool) []string {
+	var dropped []string
+	for _, kubeContext := range k.Contexts {
+		if drop(kubeContext) {
+			dropped = append(dropped, kubeContext.Name)
+		}
+	}
+	k.Contexts = without(k.Contexts, drop)
+
+	for _, name := range dropped {
+		if k.CurrentContext == name {
+			k.CurrentContext = ""
+		}
+	}
+	return dropped
+}
+
+// without returns entries with those matching drop removed
+func without[T any](entries []T, drop func(T) bool) []T {
+	kept := entries[:0]
+	for _, entry := range entries {
+		if !drop(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
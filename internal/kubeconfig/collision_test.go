@@ -0,0 +1,318 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+func contextNames(kubeconfig types.Kubeconfig) []string {
+	var names []string
+	for _, kubeContext := range kubeconfig.Contexts {
+		names = append(names, kubeContext.Name)
+	}
+	return names
+}
+
+func TestGenerateCombinedKubeconfig_CollisionFail(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-1": "prod", "c-2": "prod", "c-3": "dev"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-2", "c-3", "c-1"}, Options{})
+
+	if !errors.Is(err, types.ErrCollision) {
+		t.Fatalf("expected ErrCollision, but got: %v", err)
+	}
+	if _, err := os.Stat(tempDir + "/config"); err == nil {
+		t.Errorf("expected no output file to be written")
+	}
+
+	var kinds []string
+	for _, collision := range report.Collisions {
+		kinds = append(kinds, collision.Kind)
+		if collision.Name != "prod" || !reflect.DeepEqual(collision.ClusterIDs, []string{"c-1", "c-2"}) || collision.Resolution != types.CollisionFail {
+			t.Errorf("expected prod collision between c-1 and c-2, got %+v", collision)
+		}
+	}
+	if !reflect.DeepEqual(kinds, []string{"context", "cluster", "user"}) {
+		t.Errorf("expected context, cluster and user collisions, got %v", kinds)
+	}
+	for _, cluster := range report.Clusters {
+		if cluster.Status != types.ClusterSkipped {
+			t.Errorf("expected cluster %s to be skipped, got %s", cluster.ClusterID, cluster.Status)
+		}
+	}
+}
+
+func TestGenerateCombinedKubeconfig_CollisionSuffix(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-1": "prod", "c-2": "prod", "c-3": "dev"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-1", "c-2", "c-3"}, Options{Collisions: types.CollisionSuffix})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	kubeconfig := readKubeconfig(t, tempDir+"/config")
+	if names := contextNames(kubeconfig); !reflect.DeepEqual(names, []string{"dev", "prod-c-1", "prod-c-2"}) {
+		t.Errorf("expected suffixed contexts, got %v", names)
+	}
+	for _, kubeContext := range kubeconfig.Contexts {
+		if kubeContext.Context.Cluster != kubeContext.Name || kubeContext.Context.User != kubeContext.Name {
+			t.Errorf("expected context %s to reference the renamed cluster and user, got %+v", kubeContext.Name, kubeContext.Context)
+		}
+	}
+
+	if len(report.Collisions) != 3 {
+		t.Fatalf("expected 3 collisions, got %+v", report.Collisions)
+	}
+	expected := map[string]string{"c-1": "prod-c-1", "c-2": "prod-c-2"}
+	if collision := report.Collisions[0]; collision.Resolution != types.CollisionSuffix || !reflect.DeepEqual(collision.Renamed, expected) {
+		t.Errorf("expected renames %v, got %+v", expected, collision)
+	}
+	if contexts := report.Clusters[1].Contexts; !reflect.DeepEqual(contexts, []string{"prod-c-2"}) {
+		t.Errorf("expected report to list the renamed context, got %v", contexts)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_CollisionLastWins(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-1": "prod", "c-2": "prod", "c-3": "dev"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-2", "c-1", "c-3"}, Options{Collisions: types.CollisionLastWins})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	kubeconfig := readKubeconfig(t, tempDir+"/config")
+	if names := contextNames(kubeconfig); !reflect.DeepEqual(names, []string{"dev", "prod"}) {
+		t.Errorf("expected one prod context, got %v", names)
+	}
+	for _, cluster := range kubeconfig.Clusters {
+		if marker, _ := managedMarker(cluster.Cluster.Extensions); cluster.Name == "prod" && marker.ClusterID != "c-2" {
+			t.Errorf("expected the prod cluster of c-2 to win, got %s", marker.ClusterID)
+		}
+	}
+
+	for _, collision := range report.Collisions {
+		if collision.Winner != "c-2" || len(collision.Dropped) != 0 {
+			t.Errorf("expected c-2 to win without dependent drops, got %+v", collision)
+		}
+	}
+	if cluster := report.Clusters[1]; cluster.Status != types.ClusterSkipped || len(cluster.Contexts) != 0 {
+		t.Errorf("expected c-1 to be skipped without contexts, got %+v", cluster)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_CollisionLastWinsSharedClusterName(t *testing.T) {
+	// clusters named alike but with users and contexts named after the cluster ID
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clusterID := strings.TrimPrefix(r.URL.Path, ClusterListPath)
+		config := fmt.Sprintf(`
+clusters:
+- name: shared
+  cluster:
+    server: https://%[1]s.test
+users:
+- name: u-%[1]s
+  user:
+    token: token-%[1]s
+contexts:
+- name: %[1]s
+  context:
+    cluster: shared
+    user: u-%[1]s`, clusterID)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: config})
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-1", "c-2"}, Options{Collisions: types.CollisionLastWins})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	kubeconfig := readKubeconfig(t, tempDir+"/config")
+	if names := contextNames(kubeconfig); !reflect.DeepEqual(names, []string{"c-2"}) {
+		t.Errorf("expected only the c-2 context, got %v", names)
+	}
+	if len(kubeconfig.Users) != 1 || kubeconfig.Users[0].Name != "u-c-2" {
+		t.Errorf("expected only the user of c-2, got %+v", kubeconfig.Users)
+	}
+	data, err := os.ReadFile(tempDir + "/config")
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if strings.Contains(string(data), "token-c-1") {
+		t.Errorf("expected the token of the losing cluster not to be written")
+	}
+
+	if len(report.Collisions) != 1 || !reflect.DeepEqual(report.Collisions[0].Dropped, []string{"c-1", "u-c-1"}) {
+		t.Errorf("expected the cluster collision to drop context c-1 and user u-c-1, got %+v", report.Collisions)
+	}
+	if cluster := report.Clusters[0]; cluster.Status != types.ClusterSkipped || len(cluster.Contexts) != 0 {
+		t.Errorf("expected c-1 to be skipped without contexts, got %+v", cluster)
+	}
+	if cluster := report.Clusters[1]; cluster.Status != types.ClusterIncluded {
+		t.Errorf("expected c-2 to be included, got %+v", cluster)
+	}
+}
+
+func TestResolveCollisions_LastWinsDropsDependentContexts(t *testing.T) {
+	shared := func(contextName string) *types.Kubeconfig {
+		return &types.Kubeconfig{
+			CurrentContext: contextName,
+			Clusters:       []types.KubeconfigCluster{{Name: "shared"}},
+			Users:          []types.KubeconfigUser{{Name: "u-" + contextName}},
+			Contexts:       []types.KubeconfigContext{{Name: contextName, Context: types.KubeconfigContextDetails{Cluster: "shared", User: "u-" + contextName}}},
+		}
+	}
+	kubeconfigs := []*types.Kubeconfig{shared("a"), shared("b")}
+
+	var logs bytes.Buffer
+	opts := Options{Collisions: types.CollisionLastWins, Logger: slog.New(slog.NewTextHandler(&logs, nil))}.withDefaults()
+
+	collisions, err := resolveCollisions([]string{"c-1", "c-2"}, kubeconfigs, []int{0, 1}, opts)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if !strings.Contains(logs.String(), "dropped contexts of colliding cluster") {
+		t.Errorf("expected a warning about the dropped context, got %q", logs.String())
+	}
+
+	if len(collisions) != 1 || collisions[0].Kind != "cluster" || !reflect.DeepEqual(collisions[0].Dropped, []string{"a", "u-a"}) {
+		t.Fatalf("expected cluster collision dropping context a and user u-a, got %+v", collisions)
+	}
+	if len(kubeconfigs[0].Clusters) != 0 || len(kubeconfigs[0].Users) != 0 || len(kubeconfigs[0].Contexts) != 0 || kubeconfigs[0].CurrentContext != "" {
+		t.Errorf("expected the losing cluster, its user and its context to be dropped, got %+v", kubeconfigs[0])
+	}
+	if len(kubeconfigs[1].Contexts) != 1 {
+		t.Errorf("expected the winning context to be kept, got %+v", kubeconfigs[1].Contexts)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_MergeCollisionWithEarlierRun(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-1": "prod", "c-2": "prod"})
+	defer mockServer.Close()
+
+	// an earlier run merged the prod entries of c-1, c-2 is now also named prod
+	mergeEarlierRun := func(t *testing.T, rmsUrl string) string {
+		tempDir := t.TempDir()
+		if _, err := GenerateCombinedKubeconfig(context.Background(), rmsUrl, "mock-token", tempDir, []string{"c-1"}, Options{Merge: true}); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		return tempDir
+	}
+	clusterOwners := func(kubeconfig types.Kubeconfig) map[string]string {
+		owners := map[string]string{}
+		for _, cluster := range kubeconfig.Clusters {
+			marker, _ := managedMarker(cluster.Cluster.Extensions)
+			owners[cluster.Name] = marker.ClusterID
+		}
+		return owners
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		tempDir := mergeEarlierRun(t, mockServer.URL)
+		existing, _ := os.ReadFile(tempDir + "/config")
+
+		report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-2"}, Options{Merge: true})
+		if !errors.Is(err, types.ErrCollision) {
+			t.Fatalf("expected ErrCollision, but got: %v", err)
+		}
+		if len(report.Collisions) != 3 {
+			t.Fatalf("expected 3 collisions, got %+v", report.Collisions)
+		}
+		for _, collision := range report.Collisions {
+			if collision.Name != "prod" || !reflect.DeepEqual(collision.ClusterIDs, []string{"c-1", "c-2"}) {
+				t.Errorf("expected prod collision between c-1 and c-2, got %+v", collision)
+			}
+		}
+		if data, _ := os.ReadFile(tempDir + "/config"); string(data) != string(existing) {
+			t.Errorf("expected the entries of c-1 to be untouched")
+		}
+	})
+
+	t.Run("suffix", func(t *testing.T) {
+		tempDir := mergeEarlierRun(t, mockServer.URL)
+
+		report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-2"}, Options{Merge: true, Collisions: types.CollisionSuffix})
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		kubeconfig := readKubeconfig(t, tempDir+"/config")
+		if owners := clusterOwners(kubeconfig); !reflect.DeepEqual(owners, map[string]string{"prod-c-1": "c-1", "prod-c-2": "c-2"}) {
+			t.Errorf("expected both clusters to be suffixed, got %v", owners)
+		}
+		for _, kubeContext := range kubeconfig.Contexts {
+			if kubeContext.Context.Cluster != kubeContext.Name || kubeContext.Context.User != kubeContext.Name {
+				t.Errorf("expected context %s to reference the renamed cluster and user, got %+v", kubeContext.Name, kubeContext.Context)
+			}
+		}
+		if len(report.Collisions) != 3 || report.Collisions[0].Resolution != types.CollisionSuffix {
+			t.Errorf("expected 3 suffixed collisions, got %+v", report.Collisions)
+		}
+		if contexts := report.Clusters[0].Contexts; !reflect.DeepEqual(contexts, []string{"prod-c-2"}) {
+			t.Errorf("expected report to list the renamed context, got %v", contexts)
+		}
+	})
+
+	t.Run("last-wins", func(t *testing.T) {
+		tempDir := mergeEarlierRun(t, mockServer.URL)
+
+		report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-2"}, Options{Merge: true, Collisions: types.CollisionLastWins})
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		kubeconfig := readKubeconfig(t, tempDir+"/config")
+		if owners := clusterOwners(kubeconfig); !reflect.DeepEqual(owners, map[string]string{"prod": "c-2"}) {
+			t.Errorf("expected the prod cluster of c-2 to win, got %v", owners)
+		}
+		if len(report.Collisions) != 3 {
+			t.Fatalf("expected 3 collisions, got %+v", report.Collisions)
+		}
+		for _, collision := range report.Collisions {
+			if collision.Winner != "c-2" {
+				t.Errorf("expected c-2 to win, got %+v", collision)
+			}
+		}
+	})
+
+	t.Run("owner regenerated", func(t *testing.T) {
+		names := map[string]string{"c-1": "prod", "c-2": "prod"}
+		renamingServer := mockRMSServer(t, names)
+		defer renamingServer.Close()
+		tempDir := mergeEarlierRun(t, renamingServer.URL)
+
+		// c-1 is renamed in the same run, so its old prod entries are replaced rather than colliding
+		names["c-1"] = "production"
+		report, err := GenerateCombinedKubeconfig(context.Background(), renamingServer.URL, "mock-token", tempDir, []string{"c-1", "c-2"}, Options{Merge: true})
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		if len(report.Collisions) != 0 {
+			t.Errorf("expected no collisions, got %+v", report.Collisions)
+		}
+		owners := clusterOwners(readKubeconfig(t, tempDir+"/config"))
+		if !reflect.DeepEqual(owners, map[string]string{"prod": "c-2", "production": "c-1"}) {
+			t.Errorf("expected prod to move to c-2 and c-1 to be renamed, got %v", owners)
+		}
+	})
+}
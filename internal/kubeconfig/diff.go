@@ -0,0 +1,214 @@
+package kubeconfig
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values in a diff
+const redacted = "<redacted>"
+
+// diffField is a comparable field of a kubeconfig entry
+type diffField struct {
+	name   string
+	value  string
+	secret bool
+}
+
+// diffKubeconfig compares the kubeconfig that would be written with the existing one, which may be nil
+// Entries are matched by name, added and changed entries follow proposed order, removed ones existing order
+func diffKubeconfig(existing, proposed *types.Kubeconfig, outputFile string) *types.KubeconfigDiff {
+	if existing == nil {
+		existing = &types.Kubeconfig{}
+	}
+
+	diff := &types.KubeconfigDiff{OutputFile: outputFile}
+
+	diff.Entries = append(diff.Entries, diffEntries("cluster", existing.Clusters, proposed.Clusters,
+		func(c types.KubeconfigCluster) string { return c.Name }, clusterFields)...)
+	diff.Entries = append(diff.Entries, diffEntries("user", existing.Users, proposed.Users,
+		func(u types.KubeconfigUser) string { return u.Name }, userFields)...)
+	diff.Entries = append(diff.Entries, diffEntries("context", existing.Contexts, proposed.Contexts,
+		func(c types.KubeconfigContext) string { return c.Name }, contextFields)...)
+
+	if existing.CurrentContext != proposed.CurrentContext {
+		diff.CurrentContext = &types.FieldChange{Field: "current-context", Old: existing.CurrentContext, New: proposed.CurrentContext}
+	}
+
+	return diff
+}
+
+// diffEntries compares entries of one kind by name, the first entry wins when a name is repeated
+func diffEntries[T any](kind string, existing, proposed []T, name func(T) string, fields func(T) []diffField) []types.EntryDiff {
+	existingByName := make(map[string]T, len(existing))
+	for _, entry := range existing {
+		if _, ok := existingByName[name(entry)]; !ok {
+			existingByName[name(entry)] = entry
+		}
+	}
+	proposedNames := make(map[string]bool, len(proposed))
+
+	var diffs []types.EntryDiff
+	for _, entry := range proposed {
+		if proposedNames[name(entry)] {
+			continue
+		}
+		proposedNames[name(entry)] = true
+
+		old, ok := existingByName[name(entry)]
+		if !ok {
+			diffs = append(diffs, types.EntryDiff{Kind: kind, Name: name(entry), Action: types.DiffAdded, Changes: fieldChanges(nil, fields(entry))})
+			continue
+		}
+		if sameYAML(old, entry) {
+			continue
+		}
+
+		changes := fieldChanges(fields(old), fields(entry))
+		diffs = append(diffs, types.EntryDiff{Kind: kind, Name: name(entry), Action: types.DiffChanged, Changes: changes, OtherChanges: len(changes) == 0})
+	}
+
+	for _, entry := range existing {
+		if proposedNames[name(entry)] {
+			continue
+		}
+		proposedNames[name(entry)] = true
+		diffs = append(diffs, types.EntryDiff{Kind: kind, Name: name(entry), Action: types.DiffRemoved, Changes: fieldChanges(fields(entry), nil)})
+	}
+
+	return diffs
+}
+
+// fieldChanges lists the fields whose values differ, either side may be nil for an added or removed entry
+func fieldChanges(old, updated []diffField) []types.FieldChange {
+	values := func(fields []diffField) map[string]string {
+		m := make(map[string]string, len(fields))
+		for _, field := range fields {
+			m[field.name] = field.value
+		}
+		return m
+	}
+	oldValues, newValues := values(old), values(updated)
+
+	fields := updated
+	if fields == nil {
+		fields = old
+	}
+
+	var changes []types.FieldChange
+	for _, field := range fields {
+		oldValue, newValue := oldValues[field.name], newValues[field.name]
+		if oldValue == newValue {
+			continue
+		}
+		if field.secret {
+			oldValue, newValue = redact(oldValue), redact(newValue)
+		}
+		changes = append(changes, types.FieldChange{Field: field.name, Old: oldValue, New: newValue})
+	}
+	return changes
+}
+
+func clusterFields(c types.KubeconfigCluster) []diffField {
+	return []diffField{
+		{name: "server", value: c.Cluster.Server},
+		{name: "certificate-authority", value: c.Cluster.CertificateAuthority},
+		{name: "certificate-authority-data", value: certFingerprint(c.Cluster.CertificateAuthorityData)},
+		{name: "tls-server-name", value: c.Cluster.TLSServerName},
+		{name: "insecure-skip-tls-verify", value: boolField(c.Cluster.InsecureSkipTLSVerify)},
+		{name: "proxy-url", value: c.Cluster.ProxyURL},
+	}
+}
+
+func userFields(u types.KubeconfigUser) []diffField {
+	var authProvider, exec string
+	if u.User.AuthProvider != nil {
+		authProvider = u.User.AuthProvider.Name
+	}
+	if u.User.Exec != nil {
+		exec = strings.TrimSpace(u.User.Exec.Command + " " + strings.Join(u.User.Exec.Args, " "))
+	}
+
+	return []diffField{
+		{name: "token", value: u.User.Token, secret: true},
+		{name: "tokenFile", value: u.User.TokenFile},
+		{name: "client-certificate", value: u.User.ClientCertificate},
+		{name: "client-certificate-data", value: certFingerprint(u.User.ClientCertificateData)},
+		{name: "client-key", value: u.User.ClientKey},
+		{name: "client-key-data", value: u.User.ClientKeyData, secret: true},
+		{name: "username", value: u.User.Username},
+		{name: "password", value: u.User.Password, secret: true},
+		{name: "as", value: u.User.Impersonate},
+		{name: "auth-provider", value: authProvider},
+		{name: "exec", value: exec},
+	}
+}
+
+func contextFields(c types.KubeconfigContext) []diffField {
+	return []diffField{
+		{name: "cluster", value: c.Context.Cluster},
+		{name: "user", value: c.Context.User},
+		{name: "namespace", value: c.Context.Namespace},
+	}
+}
+
+// certFingerprint identifies base64 encoded PEM certificate data by the SHA-256 of its first certificate
+func certFingerprint(data string) string {
+	if data == "" {
+		return ""
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		raw = []byte(data)
+	}
+	if block, _ := pem.Decode(raw); block != nil {
+		raw = block.Bytes
+	}
+
+	sum := sha256.Sum256(raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func boolField(value bool) string {
+	if !value {
+		return ""
+	}
+	return strconv.FormatBool(value)
+}
+
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
+
+// sameYAML reports whether a and b serialize to the same kubeconfig content
+// Comparing the decoded YAML ignores differences such as a marker held as a struct or as a map
+func sameYAML(a, b any) bool {
+	decode := func(v any) (any, bool) {
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return nil, false
+		}
+		var decoded any
+		if err := yaml.Unmarshal(data, &decoded); err != nil {
+			return nil, false
+		}
+		return decoded, true
+	}
+
+	decodedA, okA := decode(a)
+	decodedB, okB := decode(b)
+	return okA && okB && reflect.DeepEqual(decodedA, decodedB)
+}
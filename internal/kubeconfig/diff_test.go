@@ -0,0 +1,169 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+func TestGenerateCombinedKubeconfig_DryRunMerge(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "prod", "c-dev": "dev"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	configPath := tempDir + "/config"
+	existing := []byte(fmt.Sprintf(existingKubeconfig, mockServer.URL))
+	if err := os.WriteFile(configPath, existing, 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-prod", "c-dev"}, Options{Merge: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if data, _ := os.ReadFile(configPath); string(data) != string(existing) {
+		t.Errorf("expected dry run to leave the output file untouched, got %q", data)
+	}
+	if report.Diff == nil {
+		t.Fatalf("expected a diff in the dry run report")
+	}
+
+	expected := []types.EntryDiff{
+		{Kind: "cluster", Name: "dev", Action: types.DiffAdded, Changes: []types.FieldChange{{Field: "server", New: "https://dev.test"}}},
+		{Kind: "cluster", Name: "prod", Action: types.DiffChanged, Changes: []types.FieldChange{{Field: "server", Old: "https://old-prod.test", New: "https://prod.test"}}},
+		{Kind: "user", Name: "dev", Action: types.DiffAdded, Changes: []types.FieldChange{{Field: "token", New: redacted}}},
+		{Kind: "user", Name: "prod", Action: types.DiffChanged, Changes: []types.FieldChange{{Field: "token", Old: redacted, New: redacted}}},
+		{Kind: "context", Name: "dev", Action: types.DiffAdded, Changes: []types.FieldChange{{Field: "cluster", New: "dev"}, {Field: "user", New: "dev"}}},
+	}
+	if !reflect.DeepEqual(report.Diff.Entries, expected) {
+		t.Errorf("expected diff entries %+v, got %+v", expected, report.Diff.Entries)
+	}
+	if report.Diff.CurrentContext != nil {
+		t.Errorf("expected merge to keep current-context, got %+v", report.Diff.CurrentContext)
+	}
+
+	text := report.Diff.String()
+	for _, line := range []string{"~ cluster prod", "    server: https://old-prod.test -> https://prod.test", "+ user dev", "    token: <redacted>"} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("expected diff text to contain %q, got:\n%s", line, text)
+		}
+	}
+	if strings.Contains(text, "old-token") || strings.Contains(text, "new-token") {
+		t.Errorf("expected tokens to be redacted, got:\n%s", text)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_DryRunReplace(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "prod"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	if err := os.WriteFile(tempDir+"/config", []byte(fmt.Sprintf(existingKubeconfig, mockServer.URL)), 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-prod"}, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	var removed []string
+	for _, entry := range report.Diff.Entries {
+		if entry.Action == types.DiffRemoved {
+			removed = append(removed, entry.Kind+" "+entry.Name)
+		}
+	}
+	expected := []string{"cluster kind-dev", "cluster eks-payments", "user kind-dev", "context kind-dev"}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Errorf("expected removed entries %v, got %v", expected, removed)
+	}
+
+	if cc := report.Diff.CurrentContext; cc == nil || cc.Old != "kind-dev" || cc.New != "" {
+		t.Errorf("expected current-context kind-dev to be dropped, got %+v", cc)
+	}
+	if !strings.Contains(report.Diff.String(), "~ current-context: kind-dev -> (none)\n") {
+		t.Errorf("expected current-context change in diff text, got:\n%s", report.Diff.String())
+	}
+}
+
+func TestGenerateCombinedKubeconfig_DryRunInvalidOutputFile(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "prod"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	if err := os.WriteFile(tempDir+"/config", []byte("clusters: [not, valid"), 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-prod"}, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("expected the unreadable file to be previewed as replaced, but got: %v", err)
+	}
+	var added []string
+	for _, entry := range report.Diff.Entries {
+		if entry.Action == types.DiffAdded {
+			added = append(added, entry.Kind+" "+entry.Name)
+		}
+	}
+	if expected := []string{"cluster prod", "user prod", "context prod"}; !reflect.DeepEqual(added, expected) {
+		t.Errorf("expected added entries %v, got %v", expected, added)
+	}
+
+	_, err = GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-prod"}, Options{DryRun: true, Merge: true})
+	if !errors.Is(err, types.ErrInvalidKubeconfig) {
+		t.Errorf("expected a merge preview to fail with ErrInvalidKubeconfig, but got: %v", err)
+	}
+}
+
+func TestDiffKubeconfig_NoChanges(t *testing.T) {
+	kubeconfig := &types.Kubeconfig{
+		Clusters: []types.KubeconfigCluster{{Name: "a", Cluster: types.KubeconfigClusterDetails{Server: "https://a.test"}}},
+	}
+
+	diff := diffKubeconfig(kubeconfig, kubeconfig, "/tmp/config")
+	if diff.HasChanges() {
+		t.Errorf("expected no changes, got %+v", diff)
+	}
+	if diff.String() != "/tmp/config: no changes\n" {
+		t.Errorf("expected no changes text, got %q", diff.String())
+	}
+}
+
+func TestDiffKubeconfig_OtherSettings(t *testing.T) {
+	existing := &types.Kubeconfig{Users: []types.KubeconfigUser{{Name: "a", User: types.KubeconfigUserDetails{
+		Exec: &types.KubeconfigExecConfig{Command: "login", Env: []types.KubeconfigExecEnvVar{{Name: "SECRET", Value: "one"}}},
+	}}}}
+	proposed := &types.Kubeconfig{Users: []types.KubeconfigUser{{Name: "a", User: types.KubeconfigUserDetails{
+		Exec: &types.KubeconfigExecConfig{Command: "login", Env: []types.KubeconfigExecEnvVar{{Name: "SECRET", Value: "two"}}},
+	}}}}
+
+	diff := diffKubeconfig(existing, proposed, "/tmp/config")
+	if len(diff.Entries) != 1 || !diff.Entries[0].OtherChanges || len(diff.Entries[0].Changes) != 0 {
+		t.Fatalf("expected an other settings change, got %+v", diff.Entries)
+	}
+	if text := diff.String(); !strings.Contains(text, "other settings changed") || strings.Contains(text, "two") {
+		t.Errorf("expected other settings change without values, got:\n%s", text)
+	}
+}
+
+func TestCertFingerprint(t *testing.T) {
+	pemData := "-----BEGIN CERTIFICATE-----\nY2VydA==\n-----END CERTIFICATE-----\n"
+	encoded := base64.StdEncoding.EncodeToString([]byte(pemData))
+
+	// the fingerprint covers the DER bytes ("cert"), not the encoding around them
+	expected := "sha256:06298432e8066b29e2223bcc23aa9504b56ae508fabf3435508869b9c3190e22"
+	if got := certFingerprint(encoded); got != expected {
+		t.Errorf("expected fingerprint %s, got %s", expected, got)
+	}
+	if certFingerprint("") != "" {
+		t.Errorf("expected no fingerprint for empty data")
+	}
+}
@@ -0,0 +1,410 @@
+package kubeconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// saveKubeconfig writes combined to the output file (opts.FileName) in outputPath
+// With opts.Merge the existing file is loaded and only its RMS-managed entries are replaced
+// The output file is locked from read to write so concurrent runs cannot interleave, waiting for the lock ends with ctx
+// The returned collisions are those with entries of the existing file, see outputKubeconfig
+func saveKubeconfig(ctx context.Context, combined *types.Kubeconfig, outputPath string, opts Options) ([]types.Collision, error) {
+	configPath, err := resolveConfigFile(opts.outputFile(outputPath))
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockConfigFile(ctx, configPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	existing, err := readConfigFile(configPath)
+	if err != nil {
+		// the file is about to be replaced, only a merge needs it to be readable
+		if opts.Merge {
+			return nil, err
+		}
+		existing = nil
+	}
+
+	output, collisions, err := outputKubeconfig(combined, existing, opts)
+	if err != nil {
+		return collisions, err
+	}
+
+	return collisions, writeKubeconfigFile(output, configPath, opts.Merge, opts)
+}
+
+// previewKubeconfig returns the changes saveKubeconfig would make to the output file without writing it,
+// along with the collisions saveKubeconfig would resolve
+func previewKubeconfig(combined *types.Kubeconfig, outputPath string, opts Options) (*types.KubeconfigDiff, []types.Collision, error) {
+	existing, err := readConfigFile(opts.outputFile(outputPath))
+	if err != nil {
+		// as in saveKubeconfig an unreadable file is replaced, so the diff is against an empty kubeconfig
+		if opts.Merge {
+			return nil, nil, err
+		}
+		existing = nil
+	}
+
+	output, collisions, err := outputKubeconfig(combined, existing, opts)
+	if err != nil {
+		return nil, collisions, err
+	}
+
+	return diffKubeconfig(existing, output, opts.outputFile(outputPath)), collisions, nil
+}
+
+// outputKubeconfig returns the kubeconfig to write in place of existing, which is nil when there is no output file
+// With opts.Merge combined is merged into existing and the managed entries are sorted again,
+// current-context follows opts.CurrentContext
+// Names shared with managed entries an earlier run wrote for another cluster are resolved by opts.Collisions
+// and returned, combined and existing are left untouched
+func outputKubeconfig(combined, existing *types.Kubeconfig, opts Options) (*types.Kubeconfig, []types.Collision, error) {
+	var collisions []types.Collision
+	output := combined
+	if opts.Merge && existing != nil {
+		combined, existing = copyEntries(combined), copyEntries(existing)
+
+		var err error
+		collisions, err = resolveMergeCollisions(existing, combined, opts)
+		if err != nil {
+			return nil, collisions, err
+		}
+
+		merged, err := mergeIntoExisting(existing, combined)
+		if err != nil {
+			return nil, collisions, err
+		}
+		sortManagedEntries(merged, opts.Sort)
+		output = merged
+	}
+
+	switch opts.CurrentContext {
+	case types.CurrentContextNamed, types.CurrentContextFirst:
+		output.CurrentContext = combined.CurrentContext
+	case types.CurrentContextKeep:
+		if existing != nil && existing.CurrentContext != "" && hasContext(output.Contexts, existing.CurrentContext) {
+			output.CurrentContext = existing.CurrentContext
+		}
+	}
+
+	return output, collisions, nil
+}
+
+// copyEntries returns a copy of kubeconfig whose clusters, users and contexts can be renamed or dropped
+func copyEntries(kubeconfig *types.Kubeconfig) *types.Kubeconfig {
+	copied := *kubeconfig
+	copied.Clusters = append([]types.KubeconfigCluster(nil), kubeconfig.Clusters...)
+	copied.Users = append([]types.KubeconfigUser(nil), kubeconfig.Users...)
+	copied.Contexts = append([]types.KubeconfigContext(nil), kubeconfig.Contexts...)
+	return &copied
+}
+
+// readConfigFile loads the kubeconfig at path, returning nil when the file does not exist
+func readConfigFile(path string) (*types.Kubeconfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("error reading existing kubeconfig %s, error: %v", path, err),
+			Err:     err,
+		}
+	}
+
+	var kubeconfig types.Kubeconfig
+	if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+		return nil, &types.RequestError{
+			Code:    types.ErrInvalidKubeconfigCode,
+			Message: fmt.Sprintf("error unmarshaling existing kubeconfig %s, error: %v", path, err),
+			Err:     err,
+		}
+	}
+
+	return &kubeconfig, nil
+}
+
+// mergeIntoExisting adds the entries of generated to existing, replacing entries rmskubeconfig wrote before
+// Unmanaged entries, current-context and preferences of existing are left untouched
+func mergeIntoExisting(existing, generated *types.Kubeconfig) (*types.Kubeconfig, error) {
+	merged := *existing
+	if merged.APIVersion == "" {
+		merged.APIVersion = generated.APIVersion
+	}
+	if merged.Kind == "" {
+		merged.Kind = generated.Kind
+	}
+
+	var err error
+	merged.Clusters, err = mergeEntries("cluster", existing.Clusters, generated.Clusters,
+		func(c types.KubeconfigCluster) string { return c.Name },
+		func(c types.KubeconfigCluster) []types.KubeconfigExtension { return c.Cluster.Extensions })
+	if err != nil {
+		return nil, err
+	}
+
+	merged.Users, err = mergeEntries("user", existing.Users, generated.Users,
+		func(u types.KubeconfigUser) string { return u.Name },
+		func(u types.KubeconfigUser) []types.KubeconfigExtension { return u.User.Extensions })
+	if err != nil {
+		return nil, err
+	}
+
+	merged.Contexts, err = mergeEntries("context", existing.Contexts, generated.Contexts,
+		func(c types.KubeconfigContext) string { return c.Name },
+		func(c types.KubeconfigContext) []types.KubeconfigExtension { return c.Context.Extensions })
+	if err != nil {
+		return nil, err
+	}
+
+	return &merged, nil
+}
+
+// mergeEntries replaces managed entries of existing by name or by the RMS cluster they were generated for,
+// keeping their position, and appends generated entries that are new
+// An existing entry sharing a name with a generated entry is never replaced when it is unmanaged or was
+// generated from another RMS (every Rancher has a `local` cluster)
+// Names shared with entries of another cluster of the same RMS are resolved beforehand, see resolveMergeCollisions
+func mergeEntries[T any](kind string, existing, generated []T, name func(T) string, extensions func(T) []types.KubeconfigExtension) ([]T, error) {
+	generatedByName := make(map[string]int, len(generated))
+	generatedOwners := make(map[types.ManagedMarker]bool, len(generated))
+	for i, entry := range generated {
+		generatedByName[name(entry)] = i
+		if marker, ok := managedMarker(extensions(entry)); ok {
+			generatedOwners[marker] = true
+		}
+	}
+
+	merged := make([]T, 0, len(existing)+len(generated))
+	used := make([]bool, len(generated))
+
+	for _, entry := range existing {
+		marker, managed := managedMarker(extensions(entry))
+
+		if i, ok := generatedByName[name(entry)]; ok {
+			if !managed {
+				return nil, &types.RequestError{
+					Code:    types.ErrWriteCode,
+					Message: fmt.Sprintf("refusing to replace %s %q not managed by rmskubeconfig", kind, name(entry)),
+				}
+			}
+			if generatedMarker, _ := managedMarker(extensions(generated[i])); generatedMarker.RMSUrl != marker.RMSUrl {
+				return nil, &types.RequestError{
+					Code:    types.ErrWriteCode,
+					Message: fmt.Sprintf("refusing to replace %s %q generated from another RMS (%s)", kind, name(entry), marker.RMSUrl),
+				}
+			}
+			if !used[i] {
+				merged = append(merged, generated[i])
+				used[i] = true
+			}
+			continue
+		}
+
+		// a managed entry for a regenerated cluster whose name changed
+		if managed && generatedOwners[marker] {
+			continue
+		}
+
+		merged = append(merged, entry)
+	}
+
+	for i, entry := range generated {
+		if !used[i] {
+			merged = append(merged, entry)
+		}
+	}
+
+	return merged, nil
+}
+
+// Hooks over file operations so tests can simulate failures partway through a write
+var (
+	writeData  = func(f *os.File, data []byte) error { _, err := f.Write(data); return err }
+	syncFile   = func(f *os.File) error { return f.Sync() }
+	renameFile = os.Rename
+)
+
+// writeKubeconfigFile writes kubeconfig to configPath, a path already resolved with resolveConfigFile
+// merged tells whether kubeconfig keeps entries of the existing file, see writeConfigFile for the file mode
+// yaml.v3 emits struct fields in declaration order and map keys sorted, so identical content gives identical bytes
+func writeKubeconfigFile(kubeconfig *types.Kubeconfig, configPath string, merged bool, opts Options) error {
+	kubeconfigYaml, err := yaml.Marshal(kubeconfig)
+	if err != nil {
+		return &types.RequestError{
+			Code:    types.ErrInvalidKubeconfigCode,
+			Message: fmt.Sprintf("error marshaling combined kubeconfig, error: %v", err),
+			Err:     err,
+		}
+	}
+
+	return writeConfigFile(configPath, kubeconfigYaml, merged, opts)
+}
+
+// resolveConfigFile resolves the symlinks of the kubeconfig path configPath (e.g. a dotfile-managed ~/.kube/config)
+// Locking, backups and the write all use the resolved path, so runs reaching the file through a link and
+// through its real path are serialized and the link itself is kept
+func resolveConfigFile(configPath string) (string, error) {
+	resolved, err := resolveSymlinks(configPath)
+	if err != nil {
+		return "", &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("error resolving kubeconfig %s, error: %v", configPath, err),
+			Err:     err,
+		}
+	}
+	return resolved, nil
+}
+
+// writeConfigFile replaces the kubeconfig at configPath with data, keeping a backup of the previous content
+// configPath must already be resolved with resolveConfigFile
+// The file gets opts.FileMode when set, otherwise a new file gets DefaultFileMode and an existing one keeps its mode
+// when it is owner-only or data was merged into it (merged), a replaced group- or world-readable file only
+// holds tokens of this tool and is tightened to DefaultFileMode
+func writeConfigFile(configPath string, data []byte, merged bool, opts Options) error {
+	if err := checkPermissions(configPath, merged, opts); err != nil {
+		return err
+	}
+
+	if err := backupConfigFile(configPath, data, opts); err != nil {
+		return err
+	}
+
+	perm, keepMode := opts.FileMode, false
+	if perm == 0 {
+		perm, keepMode = DefaultFileMode, true
+		if info, err := os.Stat(configPath); err == nil && !merged && info.Mode().Perm()&0077 != 0 {
+			keepMode = false
+		}
+	}
+
+	err := writeFileAtomic(configPath, data, perm, keepMode)
+	if err != nil {
+		return &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("error creating combined kubeconfig config file, error: %v", err),
+			Err:     err,
+		}
+	}
+
+	return nil
+}
+
+// checkPermissions warns about (or with opts.StrictPermissions rejects) an existing group- or world-readable
+// kubeconfig whose mode would be kept, since it is about to hold bearer tokens (kubectl warns about both)
+// Only a merged file keeps such a mode, see writeConfigFile
+func checkPermissions(path string, merged bool, opts Options) error {
+	if opts.FileMode != 0 || !merged {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm()&0044 == 0 {
+		return nil
+	}
+
+	if opts.StrictPermissions {
+		return &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("refusing to write tokens to group- or world-readable kubeconfig %s (mode %v), set a file mode such as 0600", path, info.Mode().Perm()),
+		}
+	}
+
+	opts.Logger.Warn("kubeconfig is group- or world-readable and will contain bearer tokens, set a file mode such as 0600",
+		"path", path, "mode", info.Mode().Perm().String())
+	return nil
+}
+
+// writeFileAtomic replaces path with data so readers see either the old or the new content, never a partial file
+// data is written to a temp file in the same directory, synced and renamed into place
+// With keepMode an existing file keeps its mode, ownership is kept where permitted
+// path must not be a symlink (see resolveConfigFile), renaming over it would replace the link
+func writeFileAtomic(path string, data []byte, perm os.FileMode, keepMode bool) (err error) {
+	dir := filepath.Dir(path)
+
+	existing, statErr := os.Stat(path)
+	if statErr == nil && keepMode {
+		perm = existing.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if err = writeData(tmp, data); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if statErr == nil {
+		// best effort, only privileged users can give a file away
+		_ = chownLike(tmp, existing)
+	}
+	if err = syncFile(tmp); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = renameFile(tmpPath, path); err != nil {
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// resolveSymlinks returns the file path refers to after following symlinks
+// A missing file resolves to itself, a dangling link to its target so the target gets created
+func resolveSymlinks(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	target, linkErr := os.Readlink(path)
+	if linkErr != nil {
+		return path, nil
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	return target, nil
+}
+
+// syncDir flushes the directory entry of a rename to disk, best effort
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	_ = d.Sync()
+}
@@ -0,0 +1,542 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// existingKubeconfig holds a kind entry, an EKS entry and an entry written by a previous rmskubeconfig run
+const existingKubeconfig = `apiVersion: v1
+kind: Config
+current-context: kind-dev
+preferences:
+  colors: true
+clusters:
+- name: kind-dev
+  cluster:
+    server: https://127.0.0.1:6443
+- name: prod
+  cluster:
+    server: https://old-prod.test
+    extensions:
+    - name: rmskubeconfig
+      extension:
+        rmsUrl: %[1]s
+        clusterID: c-prod
+- name: eks-payments
+  cluster:
+    server: https://eks.test
+users:
+- name: kind-dev
+  user:
+    client-certificate-data: Y2VydA==
+- name: prod
+  user:
+    token: old-token
+    extensions:
+    - name: rmskubeconfig
+      extension:
+        rmsUrl: %[1]s
+        clusterID: c-prod
+contexts:
+- name: kind-dev
+  context:
+    cluster: kind-dev
+    user: kind-dev
+- name: prod
+  context:
+    cluster: prod
+    user: prod
+    extensions:
+    - name: rmskubeconfig
+      extension:
+        rmsUrl: %[1]s
+        clusterID: c-prod
+`
+
+// mockRMSServer serves a generateKubeconfig response naming every entry after the cluster ID
+func mockRMSServer(t *testing.T, names map[string]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clusterID := strings.TrimPrefix(r.URL.Path, ClusterListPath)
+		name := names[clusterID]
+		config := fmt.Sprintf(`
+clusters:
+- name: %[1]s
+  cluster:
+    server: https://%[1]s.test
+users:
+- name: %[1]s
+  user:
+    token: new-token
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s`, name)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: config})
+	}))
+}
+
+func readKubeconfig(t *testing.T, path string) types.Kubeconfig {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	var kubeconfig types.Kubeconfig
+	if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+		t.Fatalf("Failed to unmarshal kubeconfig: %v", err)
+	}
+	return kubeconfig
+}
+
+func clusterNames(kubeconfig types.Kubeconfig) []string {
+	var names []string
+	for _, cluster := range kubeconfig.Clusters {
+		names = append(names, cluster.Name)
+	}
+	return names
+}
+
+func TestGenerateCombinedKubeconfig_Merge(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "prod", "c-dev": "dev"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	configPath := tempDir + "/config"
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(existingKubeconfig, mockServer.URL)), 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-prod", "c-dev"}, Options{Merge: true})
+	if err != nil {
+		t.Fatalf("Function returned an error: %v", err)
+	}
+
+	merged := readKubeconfig(t, configPath)
+
+	// managed entries are sorted within the positions they hold, unmanaged ones stay in place
+	expectedClusters := []string{"kind-dev", "dev", "eks-payments", "prod"}
+	if got := clusterNames(merged); strings.Join(got, ",") != strings.Join(expectedClusters, ",") {
+		t.Errorf("expected clusters %v, got %v", expectedClusters, got)
+	}
+	if merged.Clusters[3].Cluster.Server != "https://prod.test" {
+		t.Errorf("expected managed prod cluster to be replaced, got server %q", merged.Clusters[3].Cluster.Server)
+	}
+	if merged.Users[0].User.ClientCertificateData != "Y2VydA==" || merged.Users[2].Name != "prod" || merged.Users[2].User.Token != "new-token" {
+		t.Errorf("expected kind user kept and prod user replaced, got %+v", merged.Users)
+	}
+	if len(merged.Contexts) != 3 {
+		t.Errorf("expected 3 contexts, got %d", len(merged.Contexts))
+	}
+	if merged.CurrentContext != "kind-dev" || !merged.Preferences.Colors {
+		t.Errorf("expected current-context and preferences to be untouched, got %q / %+v", merged.CurrentContext, merged.Preferences)
+	}
+
+	for _, context := range merged.Contexts {
+		marker, managed := managedMarker(context.Context.Extensions)
+		if context.Name == "kind-dev" && managed {
+			t.Errorf("expected kind-dev context to stay unmanaged")
+		}
+		if context.Name == "dev" && (!managed || marker.ClusterID != "c-dev" || marker.RMSUrl != mockServer.URL) {
+			t.Errorf("expected dev context to be marked as managed for c-dev, got %+v", marker)
+		}
+	}
+}
+
+func TestGenerateCombinedKubeconfig_MergeRenamedCluster(t *testing.T) {
+	// c-prod is now called production in RMS
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "production"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	configPath := tempDir + "/config"
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(existingKubeconfig, mockServer.URL)), 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-prod"}, Options{Merge: true})
+	if err != nil {
+		t.Fatalf("Function returned an error: %v", err)
+	}
+
+	expectedClusters := []string{"kind-dev", "eks-payments", "production"}
+	if got := clusterNames(readKubeconfig(t, configPath)); strings.Join(got, ",") != strings.Join(expectedClusters, ",") {
+		t.Errorf("expected clusters %v, got %v", expectedClusters, got)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_MergeUnmanagedCollision(t *testing.T) {
+	// RMS cluster named like the unmanaged kind cluster
+	mockServer := mockRMSServer(t, map[string]string{"c-kind": "kind-dev"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	configPath := tempDir + "/config"
+	existing := []byte(fmt.Sprintf(existingKubeconfig, mockServer.URL))
+	if err := os.WriteFile(configPath, existing, 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-kind"}, Options{Merge: true})
+	if !errors.Is(err, types.ErrWrite) {
+		t.Fatalf("expected write error, but got: %v", err)
+	}
+
+	data, _ := os.ReadFile(configPath)
+	if string(data) != string(existing) {
+		t.Errorf("expected existing config to be untouched")
+	}
+}
+
+func TestGenerateCombinedKubeconfig_MergeOtherRMSCollision(t *testing.T) {
+	// every Rancher has a local cluster
+	serverA := mockRMSServer(t, map[string]string{"local": "local"})
+	defer serverA.Close()
+	serverB := mockRMSServer(t, map[string]string{"local": "local"})
+	defer serverB.Close()
+
+	tempDir := t.TempDir()
+	configPath := tempDir + "/config"
+	if _, err := GenerateCombinedKubeconfig(context.Background(), serverA.URL, "mock-token", tempDir, []string{"local"}, Options{Merge: true}); err != nil {
+		t.Fatalf("Function returned an error: %v", err)
+	}
+	existing, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to read output file: %v", err)
+	}
+
+	_, err = GenerateCombinedKubeconfig(context.Background(), serverB.URL, "mock-token", tempDir, []string{"local"}, Options{Merge: true})
+	if !errors.Is(err, types.ErrWrite) || !strings.Contains(err.Error(), "another RMS") {
+		t.Fatalf("expected write error for an entry of another RMS, but got: %v", err)
+	}
+
+	data, _ := os.ReadFile(configPath)
+	if string(data) != string(existing) {
+		t.Errorf("expected the entries of the first RMS to be untouched")
+	}
+
+	// the same RMS still replaces its own entries
+	if _, err := GenerateCombinedKubeconfig(context.Background(), serverA.URL, "mock-token", tempDir, []string{"local"}, Options{Merge: true}); err != nil {
+		t.Errorf("expected no error merging from the same RMS, but got: %v", err)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_MergeTrailingSlashRMSUrl(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "prod"})
+	defer mockServer.Close()
+
+	// entries written while the RMS URL was set with a trailing slash are still ours
+	tempDir := t.TempDir()
+	configPath := tempDir + "/config"
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(existingKubeconfig, mockServer.URL+"/")), 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-prod"}, Options{Merge: true})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	merged := readKubeconfig(t, configPath)
+	if merged.Users[1].Name != "prod" || merged.Users[1].User.Token != "new-token" {
+		t.Errorf("expected the prod user to be replaced, got %+v", merged.Users)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_MergeWithoutExistingFile(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-dev": "dev"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-dev"}, Options{Merge: true})
+	if err != nil {
+		t.Fatalf("Function returned an error: %v", err)
+	}
+
+	merged := readKubeconfig(t, tempDir+"/config")
+	if merged.APIVersion != "v1" || merged.Kind != "Config" || len(merged.Clusters) != 1 {
+		t.Errorf("expected a new kubeconfig with one cluster, got %+v", merged)
+	}
+}
+
+func TestReadConfigFile_Invalid(t *testing.T) {
+	path := t.TempDir() + "/config"
+	if err := os.WriteFile(path, []byte("clusters: [not, valid"), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	_, err := readConfigFile(path)
+	if !errors.Is(err, types.ErrInvalidKubeconfig) {
+		t.Errorf("expected invalid kubeconfig error, but got: %v", err)
+	}
+}
+
+// assertNoTempFiles fails when a temp file from an interrupted write is left in dir
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("expected temp file %s to be cleaned up", entry.Name())
+		}
+	}
+}
+
+func TestSaveKubeconfig_FailurePartwayKeepsExisting(t *testing.T) {
+	kubeconfig := &types.Kubeconfig{APIVersion: "v1", Kind: "Config", Clusters: []types.KubeconfigCluster{
+		{Name: "new", Cluster: types.KubeconfigClusterDetails{Server: "https://new.test"}},
+	}}
+	failure := errors.New("no space left on device")
+
+	tests := []struct {
+		name    string
+		install func() func()
+	}{
+		{"write", func() func() {
+			original := writeData
+			writeData = func(f *os.File, data []byte) error {
+				f.Write(data[:len(data)/2])
+				return failure
+			}
+			return func() { writeData = original }
+		}},
+		{"sync", func() func() {
+			original := syncFile
+			syncFile = func(f *os.File) error { return failure }
+			return func() { syncFile = original }
+		}},
+		{"rename", func() func() {
+			original := renameFile
+			renameFile = func(oldpath, newpath string) error { return failure }
+			return func() { renameFile = original }
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			existing := []byte("apiVersion: v1\nkind: Config\n")
+			if err := os.WriteFile(tempDir+"/config", existing, 0600); err != nil {
+				t.Fatalf("failed to write existing config: %v", err)
+			}
+
+			restore := test.install()
+			_, err := saveKubeconfig(context.Background(), kubeconfig, tempDir, Options{}.withDefaults())
+			restore()
+
+			if !errors.Is(err, failure) || !errors.Is(err, types.ErrWrite) {
+				t.Fatalf("expected write error wrapping %v, got: %v", failure, err)
+			}
+
+			if data, _ := os.ReadFile(tempDir + "/config"); string(data) != string(existing) {
+				t.Errorf("expected existing config to be intact, got %q", data)
+			}
+			assertNoTempFiles(t, tempDir)
+		})
+	}
+}
+
+func TestSaveKubeconfig_KeepsExistingMode(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(tempDir+"/config", []byte("apiVersion: v1\n"), 0640); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+	if err := os.Chmod(tempDir+"/config", 0640); err != nil {
+		t.Fatalf("failed to chmod existing config: %v", err)
+	}
+
+	if _, err := saveKubeconfig(context.Background(), &types.Kubeconfig{APIVersion: "v1", Kind: "Config"}, tempDir, Options{Merge: true}.withDefaults()); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	info, err := os.Stat(tempDir + "/config")
+	if err != nil {
+		t.Fatalf("failed to stat config: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 0640 to be kept, got %v", info.Mode().Perm())
+	}
+	assertNoTempFiles(t, tempDir)
+}
+
+func TestSaveKubeconfig_Symlink(t *testing.T) {
+	tempDir := t.TempDir()
+	dotfiles := tempDir + "/dotfiles"
+	kubeDir := tempDir + "/kube"
+	for _, dir := range []string{dotfiles, kubeDir} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(dotfiles+"/kubeconfig", []byte("apiVersion: v1\n"), 0640); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+	if err := os.Chmod(dotfiles+"/kubeconfig", 0640); err != nil {
+		t.Fatalf("failed to chmod existing config: %v", err)
+	}
+	if err := os.Symlink("../dotfiles/kubeconfig", kubeDir+"/config"); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	kubeconfig := &types.Kubeconfig{APIVersion: "v1", Kind: "Config", Clusters: []types.KubeconfigCluster{
+		{Name: "new", Cluster: types.KubeconfigClusterDetails{Server: "https://new.test"}},
+	}}
+	if _, err := saveKubeconfig(context.Background(), kubeconfig, kubeDir, Options{Backups: 0, Merge: true}.withDefaults()); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if info, err := os.Lstat(kubeDir + "/config"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected config to remain a symlink, got %v, %v", info, err)
+	}
+	if names := clusterNames(readKubeconfig(t, dotfiles+"/kubeconfig")); len(names) != 1 || names[0] != "new" {
+		t.Errorf("expected the link target to hold the new content, got %v", names)
+	}
+	if info, err := os.Stat(dotfiles + "/kubeconfig"); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("expected the link target to keep mode 0640, got %v, %v", info, err)
+	}
+	assertNoTempFiles(t, kubeDir)
+	assertNoTempFiles(t, dotfiles)
+
+	// a dangling link gets its target created
+	if err := os.Symlink("../dotfiles/new-kubeconfig", kubeDir+"/dangling"); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if _, err := saveKubeconfig(context.Background(), kubeconfig, kubeDir, Options{FileName: "dangling"}.withDefaults()); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if info, err := os.Lstat(kubeDir + "/dangling"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected dangling to remain a symlink, got %v, %v", info, err)
+	}
+	if _, err := os.Stat(dotfiles + "/new-kubeconfig"); err != nil {
+		t.Errorf("expected the link target to be created, error: %v", err)
+	}
+}
+
+func TestSaveKubeconfig_FileMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing os.FileMode
+		fileMode os.FileMode
+		merge    bool
+		expected os.FileMode
+	}{
+		{"new file defaults to owner-only", 0, 0, false, DefaultFileMode},
+		{"new file with explicit mode", 0, 0640, false, 0640},
+		{"existing file forced to explicit mode", 0644, 0600, false, 0600},
+		{"replaced readable file tightened", 0644, 0, false, DefaultFileMode},
+		{"replaced owner-only file keeps mode", 0400, 0, false, 0400},
+		{"merged readable file keeps mode", 0644, 0, true, 0644},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			if test.existing != 0 {
+				if err := os.WriteFile(tempDir+"/config", []byte("apiVersion: v1\n"), test.existing); err != nil {
+					t.Fatalf("failed to write existing config: %v", err)
+				}
+				if err := os.Chmod(tempDir+"/config", test.existing); err != nil {
+					t.Fatalf("failed to chmod existing config: %v", err)
+				}
+			}
+
+			opts := Options{FileMode: test.fileMode, Merge: test.merge}.withDefaults()
+			if _, err := saveKubeconfig(context.Background(), &types.Kubeconfig{APIVersion: "v1", Kind: "Config"}, tempDir, opts); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			info, err := os.Stat(tempDir + "/config")
+			if err != nil {
+				t.Fatalf("failed to stat config: %v", err)
+			}
+			if info.Mode().Perm() != test.expected {
+				t.Errorf("expected mode %v, got %v", test.expected, info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestSaveKubeconfig_ReadableByOthers(t *testing.T) {
+	writeReadable := func(t *testing.T, mode os.FileMode) string {
+		tempDir := t.TempDir()
+		if err := os.WriteFile(tempDir+"/config", []byte("apiVersion: v1\n"), mode); err != nil {
+			t.Fatalf("failed to write existing config: %v", err)
+		}
+		if err := os.Chmod(tempDir+"/config", mode); err != nil {
+			t.Fatalf("failed to chmod existing config: %v", err)
+		}
+		return tempDir
+	}
+	kubeconfig := &types.Kubeconfig{APIVersion: "v1", Kind: "Config"}
+
+	for _, mode := range []os.FileMode{0644, 0640, 0604} {
+		t.Run("warns "+mode.String(), func(t *testing.T) {
+			tempDir := writeReadable(t, mode)
+			var logs strings.Builder
+			opts := Options{Merge: true, Logger: slog.New(slog.NewTextHandler(&logs, nil))}.withDefaults()
+
+			if _, err := saveKubeconfig(context.Background(), kubeconfig, tempDir, opts); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if !strings.Contains(logs.String(), "group- or world-readable") {
+				t.Errorf("expected a readable-by-others warning, got %q", logs.String())
+			}
+		})
+	}
+
+	t.Run("owner-only does not warn", func(t *testing.T) {
+		tempDir := writeReadable(t, 0600)
+		var logs strings.Builder
+		opts := Options{Merge: true, Logger: slog.New(slog.NewTextHandler(&logs, nil))}.withDefaults()
+
+		if _, err := saveKubeconfig(context.Background(), kubeconfig, tempDir, opts); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		if logs.Len() != 0 {
+			t.Errorf("expected no warning, got %q", logs.String())
+		}
+	})
+
+	t.Run("replace does not warn", func(t *testing.T) {
+		tempDir := writeReadable(t, 0644)
+		var logs strings.Builder
+		opts := Options{StrictPermissions: true, Logger: slog.New(slog.NewTextHandler(&logs, nil))}.withDefaults()
+
+		if _, err := saveKubeconfig(context.Background(), kubeconfig, tempDir, opts); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		if logs.Len() != 0 {
+			t.Errorf("expected no warning, got %q", logs.String())
+		}
+	})
+
+	t.Run("strict fails", func(t *testing.T) {
+		tempDir := writeReadable(t, 0640)
+		opts := Options{Merge: true, StrictPermissions: true}.withDefaults()
+
+		_, err := saveKubeconfig(context.Background(), kubeconfig, tempDir, opts)
+		if !errors.Is(err, types.ErrWrite) {
+			t.Fatalf("expected ErrWrite, but got: %v", err)
+		}
+		if data, _ := os.ReadFile(tempDir + "/config"); string(data) != "apiVersion: v1\n" {
+			t.Errorf("expected existing config to be untouched, got %q", data)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// LocalClusterID is the ID of the Rancher management cluster
+const LocalClusterID string = "local"
+
+// ClusterFilter selects the clusters a kubeconfig is generated for
+// A cluster is kept when it matches Include (or Include is empty), does not match Exclude and matches the selectors
+type ClusterFilter struct {
+	Include ClusterMatch
+	Exclude ClusterMatch
+	// LabelSelector is a Kubernetes-style selector on cluster labels, e.g. `env in (prod,stage),team=payments,!deprecated`
+	LabelSelector string
+	// AnnotationSelector is a selector of the same syntax on cluster annotations
+	AnnotationSelector string
+	// SkipLocal drops the Rancher management cluster (ID `local`)
+	SkipLocal bool
+}
+
+// ClusterMatch matches a cluster by any of its rules
+type ClusterMatch struct {
+	// Names are glob patterns (path.Match syntax) matched against the cluster name
+	Names []string
+	// NameRegexps are regular expressions matched against the cluster name, anchor them to match the whole name
+	NameRegexps []string
+	// IDs are exact cluster IDs
+	IDs []string
+}
+
+// clusterMatcher is a ClusterMatch with its regular expressions compiled
+type clusterMatcher struct {
+	names   []string
+	regexps []*regexp.Regexp
+	ids     map[string]bool
+}
+
+// Validate checks the glob patterns, regular expressions and selectors of the filter
+func (f ClusterFilter) Validate() error {
+	if _, err := f.Include.compile(); err != nil {
+		return fmt.Errorf("invalid include filter: %v", err)
+	}
+	if _, err := f.Exclude.compile(); err != nil {
+		return fmt.Errorf("invalid exclude filter: %v", err)
+	}
+	if _, err := parseSelector(f.LabelSelector); err != nil {
+		return fmt.Errorf("invalid label selector: %v", err)
+	}
+	if _, err := parseSelector(f.AnnotationSelector); err != nil {
+		return fmt.Errorf("invalid annotation selector: %v", err)
+	}
+	return nil
+}
+
+// FilterClusters returns the clusters selected by filter, keeping their order
+func FilterClusters(clusters []types.RMSCluster, filter ClusterFilter) ([]types.RMSCluster, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	include, _ := filter.Include.compile()
+	exclude, _ := filter.Exclude.compile()
+	labels, _ := parseSelector(filter.LabelSelector)
+	annotations, _ := parseSelector(filter.AnnotationSelector)
+
+	var selected []types.RMSCluster
+	for _, cluster := range clusters {
+		if filter.SkipLocal && cluster.ID == LocalClusterID {
+			continue
+		}
+		if !include.empty() && !include.matches(cluster) {
+			continue
+		}
+		if exclude.matches(cluster) {
+			continue
+		}
+		if !labels.matches(cluster.Labels) || !annotations.matches(cluster.Annotations) {
+			continue
+		}
+		selected = append(selected, cluster)
+	}
+
+	return selected, nil
+}
+
+func (m ClusterMatch) compile() (*clusterMatcher, error) {
+	matcher := &clusterMatcher{names: m.Names, ids: make(map[string]bool, len(m.IDs))}
+
+	for _, pattern := range m.Names {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("name pattern %q: %v", pattern, err)
+		}
+	}
+	for _, expr := range m.NameRegexps {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("name regexp %q: %v", expr, err)
+		}
+		matcher.regexps = append(matcher.regexps, re)
+	}
+	for _, id := range m.IDs {
+		matcher.ids[id] = true
+	}
+
+	return matcher, nil
+}
+
+// empty reports whether the matcher has no rules
+func (m *clusterMatcher) empty() bool {
+	return len(m.names) == 0 && len(m.regexps) == 0 && len(m.ids) == 0
+}
+
+// matches reports whether cluster matches any rule
+func (m *clusterMatcher) matches(cluster types.RMSCluster) bool {
+	if m.ids[cluster.ID] {
+		return true
+	}
+	for _, pattern := range m.names {
+		if ok, _ := path.Match(pattern, cluster.Name); ok {
+			return true
+		}
+	}
+	for _, re := range m.regexps {
+		if re.MatchString(cluster.Name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package kubeconfig
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+func TestFilterClusters(t *testing.T) {
+	clusters := []types.RMSCluster{
+		{ID: "local", Name: "local"},
+		{ID: "c-1", Name: "prod-eu", Labels: map[string]string{"env": "prod", "team": "payments"}},
+		{ID: "c-2", Name: "prod-us", Labels: map[string]string{"env": "prod", "team": "search"}, Annotations: map[string]string{"owner": "search"}},
+		{ID: "c-3", Name: "dev-eu", Labels: map[string]string{"env": "dev", "team": "payments"}},
+		{ID: "c-4", Name: "sandbox"},
+	}
+
+	tests := []struct {
+		name     string
+		filter   ClusterFilter
+		expected []string
+	}{
+		{"no filter", ClusterFilter{}, []string{"local", "c-1", "c-2", "c-3", "c-4"}},
+		{"skip local", ClusterFilter{SkipLocal: true}, []string{"c-1", "c-2", "c-3", "c-4"}},
+		{"include glob", ClusterFilter{Include: ClusterMatch{Names: []string{"prod-*"}}}, []string{"c-1", "c-2"}},
+		{"include regexp", ClusterFilter{Include: ClusterMatch{NameRegexps: []string{`-eu$`}}}, []string{"c-1", "c-3"}},
+		{"include any rule", ClusterFilter{Include: ClusterMatch{Names: []string{"dev-*"}, IDs: []string{"c-4"}}}, []string{"c-3", "c-4"}},
+		{"exclude ids", ClusterFilter{Exclude: ClusterMatch{IDs: []string{"c-2", "c-4"}}}, []string{"local", "c-1", "c-3"}},
+		{"exclude wins", ClusterFilter{Include: ClusterMatch{Names: []string{"prod-*"}}, Exclude: ClusterMatch{NameRegexps: []string{"us"}}}, []string{"c-1"}},
+		{"nothing matches", ClusterFilter{Include: ClusterMatch{IDs: []string{"c-9"}}}, nil},
+		{"label selector", ClusterFilter{LabelSelector: "team=payments"}, []string{"c-1", "c-3"}},
+		{"label and annotation selector", ClusterFilter{LabelSelector: "env in (prod,stage)", AnnotationSelector: "!owner"}, []string{"c-1"}},
+		{"selector and exclude", ClusterFilter{LabelSelector: "team", Exclude: ClusterMatch{Names: []string{"dev-*"}}}, []string{"c-1", "c-2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, err := FilterClusters(clusters, test.filter)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			var ids []string
+			for _, cluster := range selected {
+				ids = append(ids, cluster.ID)
+			}
+			if !reflect.DeepEqual(ids, test.expected) {
+				t.Errorf("expected clusters %v, got %v", test.expected, ids)
+			}
+		})
+	}
+}
+
+func TestClusterFilter_Validate(t *testing.T) {
+	invalid := []ClusterFilter{
+		{Include: ClusterMatch{Names: []string{"prod-["}}},
+		{Exclude: ClusterMatch{NameRegexps: []string{"(unclosed"}}},
+		{LabelSelector: "env in prod"},
+		{AnnotationSelector: "owner=,"},
+	}
+	for _, filter := range invalid {
+		if err := filter.Validate(); err == nil {
+			t.Errorf("expected error for %+v, but got nil", filter)
+		}
+	}
+}
@@ -1,10 +1,17 @@
 package kubeconfig
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
 
@@ -13,123 +20,557 @@ import (
 
 const ClusterListPath string = "/v3/clusters/"
 const GenerateKubeconfigUrlAction string = "generateKubeconfig"
+const ConfigFileName string = "config"
 
-// GetClusters retrieves a list of all clusters from RMS
-func GetClusters(baseUrl, apiToken string) ([]types.RMSCluster, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", baseUrl+ClusterListPath, nil)
+// GetClusters retrieves a list of all clusters from RMS, following pagination links until the collection is exhausted
+// A pagination link to another scheme or host than baseUrl is rejected, the API token is sent with every page
+func GetClusters(ctx context.Context, baseUrl, apiToken string, opts Options) ([]types.RMSCluster, error) {
+	opts = opts.withDefaults()
+
+	pageUrl, err := clusterListUrl(baseUrl, opts.PageLimit)
 	if err != nil {
 		return nil, &types.RequestError{
 			Code:    types.ErrRequestCode,
 			Message: fmt.Sprintf("error creating cluster request: %v", err),
+			Err:     err,
 		}
 	}
 
-	req.Header.Set("Authorization", "Bearer "+apiToken)
+	var clusters []types.RMSCluster
+	visited := map[string]bool{}
+
+	for pageUrl != "" {
+		if visited[pageUrl] {
+			return nil, &types.RequestError{
+				Code:    types.ErrDecodeCode,
+				Message: fmt.Sprintf("pagination loop detected fetching clusters: %s", pageUrl),
+			}
+		}
+		visited[pageUrl] = true
 
-	resp, err := client.Do(req)
+		clusterResp, err := getClusterPage(ctx, opts, pageUrl, apiToken)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, clusterResp.Data...)
+
+		pageUrl = ""
+		if clusterResp.Pagination != nil && clusterResp.Pagination.Next != "" {
+			pageUrl, err = resolveUrl(clusterResp.Pagination.Next, baseUrl)
+			if err != nil {
+				return nil, &types.RequestError{
+					Code:    types.ErrDecodeCode,
+					Message: fmt.Sprintf("error parsing next page link: %v", err),
+					Err:     err,
+				}
+			}
+			if !sameOrigin(pageUrl, baseUrl) {
+				return nil, &types.RequestError{
+					Code:    types.ErrDecodeCode,
+					Message: fmt.Sprintf("next page link %s points away from %s", pageUrl, baseUrl),
+				}
+			}
+		}
+	}
+
+	return clusters, nil
+
+}
+
+// getClusterPage retrieves a single page of the cluster collection
+func getClusterPage(ctx context.Context, opts Options, pageUrl, apiToken string) (*types.RMSClusterResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageUrl, nil)
 	if err != nil {
 		return nil, &types.RequestError{
 			Code:    types.ErrRequestCode,
-			Message: fmt.Sprintf("error fetching clusters: %v", err),
+			Message: fmt.Sprintf("error creating cluster request: %v", err),
+			Err:     err,
 		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	req.Header.Set("Authorization", "Bearer "+apiToken)
+
+	resp, err := doRequest(ctx, opts, req)
+	if err != nil {
 		return nil, &types.RequestError{
-			Code:    types.ErrRequestCode,
-			Message: fmt.Sprintf("unexpected response status fetching clusters: %v", resp.Status),
+			Code:     types.ErrTransportCode,
+			Message:  fmt.Sprintf("error fetching clusters: %v", err),
+			Attempts: resp.Attempts,
+			Err:      err,
 		}
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp, "unexpected response status fetching clusters")
+	}
+
 	var clusterResp types.RMSClusterResponse
-	if err := json.NewDecoder(resp.Body).Decode(&clusterResp); err != nil {
+	if err := json.Unmarshal(resp.Body, &clusterResp); err != nil {
 		return nil, &types.RequestError{
-			Code:    types.ErrRequestCode,
-			Message: fmt.Sprintf("error decoding cluster response: %v", err),
+			Code:       types.ErrDecodeCode,
+			Message:    fmt.Sprintf("error decoding cluster response: %v", err),
+			Attempts:   resp.Attempts,
+			StatusCode: resp.StatusCode,
+			Err:        err,
+		}
+	}
+
+	return &clusterResp, nil
+}
+
+// clusterListUrl builds the first cluster list URL, adding the page limit when set
+func clusterListUrl(baseUrl string, limit int) (string, error) {
+	listUrl, err := url.Parse(baseUrl + ClusterListPath)
+	if err != nil {
+		return "", err
+	}
+
+	if limit > 0 {
+		query := listUrl.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		listUrl.RawQuery = query.Encode()
+	}
+
+	return listUrl.String(), nil
+}
+
+// resolveUrl resolves a (possibly relative) link returned by RMS against the base URL
+func resolveUrl(link, baseUrl string) (string, error) {
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return "", err
+	}
+
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+
+	return base.ResolveReference(ref).String(), nil
+}
+
+// sameOrigin reports whether link has the scheme and host of baseUrl
+func sameOrigin(link, baseUrl string) bool {
+	linkUrl, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(linkUrl.Scheme, base.Scheme) && strings.EqualFold(linkUrl.Host, base.Host)
+}
+
+// GenerateCombinedKubeconfig combines all generated kubeconfig files into one kubeconfig file (opts.FileName) in outputPath
+// Kubeconfigs are generated concurrently (bounded by opts.Concurrency), entries are ordered by opts.Sort
+// Generation stops early when ctx is cancelled or its deadline passes
+// With opts.DryRun nothing is written, the report carries the diff against the existing output file instead
+// The returned report describes the outcome of every cluster, including when an error is returned
+func GenerateCombinedKubeconfig(ctx context.Context, baseUrl, apiToken, outputPath string, clusterIDs []string, opts Options) (*types.GenerateReport, error) {
+	opts = opts.withDefaults()
+
+	// an empty cluster list usually means a bad token or filter, don't replace a good kubeconfig with it
+	if len(clusterIDs) == 0 && !opts.AllowEmpty && !opts.Merge && !opts.DryRun {
+		outputFile := opts.outputFile(outputPath)
+		if _, err := os.Stat(outputFile); err == nil {
+			return &types.GenerateReport{}, &types.RequestError{
+				Code:    types.ErrWriteCode,
+				Message: fmt.Sprintf("refusing to overwrite %s with an empty cluster list", outputFile),
+			}
+		}
+	}
+
+	combinedKubeconfig, report, err := BuildCombinedKubeconfig(ctx, baseUrl, apiToken, clusterIDs, opts)
+	if combinedKubeconfig == nil {
+		return report, err
+	}
+
+	if opts.DryRun {
+		diff, collisions, previewErr := previewKubeconfig(combinedKubeconfig, outputPath, opts)
+		addMergeCollisions(report, collisions)
+		if previewErr != nil {
+			return report, previewErr
+		}
+		report.Diff = diff
+	} else {
+		collisions, writeErr := saveKubeconfig(ctx, combinedKubeconfig, outputPath, opts)
+		addMergeCollisions(report, collisions)
+		if writeErr != nil {
+			// nothing made it to disk
+			for i := range report.Clusters {
+				if report.Clusters[i].Status == types.ClusterIncluded {
+					report.Clusters[i].Status = types.ClusterSkipped
+				}
+			}
+			return report, writeErr
 		}
 	}
 
-	return clusterResp.Data, nil
+	report.OutputFile = opts.outputFile(outputPath)
+
+	return report, err
+
+}
+
+// addMergeCollisions adds the collisions with entries of the output file to report,
+// following the contexts renamed with types.CollisionSuffix
+func addMergeCollisions(report *types.GenerateReport, collisions []types.Collision) {
+	report.Collisions = append(report.Collisions, collisions...)
 
+	for _, c := range collisions {
+		if c.Kind != "context" || c.Renamed == nil {
+			continue
+		}
+		for i := range report.Clusters {
+			renamed, ok := c.Renamed[report.Clusters[i].ClusterID]
+			if !ok {
+				continue
+			}
+			for j, name := range report.Clusters[i].Contexts {
+				if name == c.Name {
+					report.Clusters[i].Contexts[j] = renamed
+				}
+			}
+		}
+	}
 }
 
-// GenerateCombinedKubeconfig combines all generated kubeconfig files into one kubeconfig (config) file
-func GenerateCombinedKubeconfig(baseUrl, apiToken, outputPath string, clusterIDs []string) error {
-	client := &http.Client{}
+// BuildCombinedKubeconfig generates the kubeconfig of every cluster and merges them in memory, nothing is written
+// Kubeconfigs are generated concurrently (bounded by opts.Concurrency), entries are ordered by opts.Sort
+// and names shared by several clusters are resolved by opts.Collisions, after opts.NameTemplate renamed them
+// The kubeconfig is nil when nothing can be built: ctx is done, a cluster failed (unless opts.ContinueOnError),
+// every cluster failed or names collide with types.CollisionFail
+// Without opts.ContinueOnError the first failure cancels the requests in flight, their clusters are reported as skipped
+// With opts.ContinueOnError a partial kubeconfig is returned along with a *types.GenerateError
+// The returned report describes the outcome of every cluster, including when an error is returned
+func BuildCombinedKubeconfig(ctx context.Context, baseUrl, apiToken string, clusterIDs []string, opts Options) (*types.Kubeconfig, *types.GenerateReport, error) {
+	opts = opts.withDefaults()
 	combinedKubeconfig := &types.Kubeconfig{
 		APIVersion: "v1",
 		Kind:       "Config",
 	}
 
-	for _, clusterID := range clusterIDs {
+	report := &types.GenerateReport{Clusters: make([]types.ClusterResult, len(clusterIDs))}
+	kubeconfigs := make([]*types.Kubeconfig, len(clusterIDs))
+	errs := make([]error, len(clusterIDs))
+	host := rmsHost(baseUrl)
 
-		url := fmt.Sprintf("%s%s%s?action=%s", baseUrl, ClusterListPath, clusterID, GenerateKubeconfigUrlAction)
-		req, err := http.NewRequest("POST", url, nil)
-		if err != nil {
-			return &types.RequestError{
-				Code:    types.ErrRequestCode,
-				Message: fmt.Sprintf("error creating generate kubeconfig request: %v", err),
+	// a failure (unless continuing on error) cancels the requests in flight, each would create a token in RMS
+	// for a kubeconfig that is never written
+	generateCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < opts.concurrency(len(clusterIDs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := time.Now()
+				kubeconfigs[i], errs[i] = generateKubeconfig(generateCtx, opts, baseUrl, apiToken, clusterIDs[i])
+				if errs[i] == nil && opts.NameTemplate != nil {
+					if errs[i] = nameEntries(kubeconfigs[i], clusterIDs[i], host, opts); errs[i] != nil {
+						kubeconfigs[i] = nil
+					}
+				}
+				report.Clusters[i].Duration = time.Since(start)
+				if errs[i] != nil && !opts.ContinueOnError {
+					stop()
+				}
 			}
+		}()
+	}
+
+	// dispatch jobs until all are queued, a job fails (unless continuing on error) or ctx is done
+dispatch:
+	for i := range clusterIDs {
+		select {
+		case jobs <- i:
+		case <-generateCtx.Done():
+			break dispatch
 		}
+	}
+	close(jobs)
+	wg.Wait()
 
-		req.Header.Set("Authorization", "Bearer "+apiToken)
+	// record every cluster as skipped until it is known to be included or failed
+	// a request cancelled after another cluster failed did not fail itself
+	stoppedEarly := generateCtx.Err() != nil && ctx.Err() == nil
+	var failures []*types.RequestError
+	for i, clusterID := range clusterIDs {
+		report.Clusters[i].ClusterID = clusterID
+		report.Clusters[i].Status = types.ClusterSkipped
+		if errs[i] != nil && stoppedEarly && errors.Is(errs[i], context.Canceled) {
+			kubeconfigs[i] = nil
+			continue
+		}
+		if errs[i] != nil {
+			reqErr := asClusterRequestError(errs[i], clusterID)
+			report.Clusters[i].Status = types.ClusterFailed
+			report.Clusters[i].Err = reqErr
+			failures = append(failures, reqErr)
+		}
+		if kubeconfigs[i] != nil {
+			for _, kubeContext := range kubeconfigs[i].Contexts {
+				report.Clusters[i].Contexts = append(report.Clusters[i].Contexts, kubeContext.Name)
+			}
+		}
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			return &types.RequestError{
-				Code:    types.ErrRequestCode,
-				Message: fmt.Sprintf("error fetching kubeconfig generate for cluster: %s, error: %v", clusterID, err),
+	if err := ctx.Err(); err != nil {
+		return nil, report, &types.RequestError{
+			Code:    types.ErrTransportCode,
+			Message: fmt.Sprintf("kubeconfig generation cancelled: %v", err),
+			Err:     err,
+		}
+	}
+
+	if len(failures) > 0 && !opts.ContinueOnError {
+		return nil, report, failures[0]
+	}
+
+	// nothing succeeded, keep any existing output rather than writing an empty kubeconfig
+	if len(failures) > 0 && len(failures) == len(clusterIDs) {
+		return nil, report, &types.GenerateError{Failures: failures, Total: len(clusterIDs)}
+	}
+
+	// merge in a fixed order so output is stable regardless of completion and listing order
+	order := mergeOrder(clusterIDs, opts)
+
+	collisions, err := resolveCollisions(clusterIDs, kubeconfigs, order, opts)
+	report.Collisions = collisions
+	if err != nil {
+		return nil, report, err
+	}
+
+	for _, i := range order {
+		if kubeconfigs[i] == nil {
+			continue
+		}
+		mergeKubeconfig(combinedKubeconfig, kubeconfigs[i])
+	}
+	sortKubeconfig(combinedKubeconfig, opts.Sort)
+
+	if err := selectCurrentContext(combinedKubeconfig, clusterIDs, kubeconfigs, opts); err != nil {
+		return nil, report, err
+	}
+
+	for i := range clusterIDs {
+		if kubeconfigs[i] != nil {
+			// a cluster whose every context was dropped by a collision is not in the output
+			if len(report.Clusters[i].Contexts) > 0 && len(kubeconfigs[i].Contexts) == 0 {
+				report.Clusters[i].Contexts = nil
+				continue
+			}
+			report.Clusters[i].Status = types.ClusterIncluded
+			// contexts as written, after collisions were resolved
+			report.Clusters[i].Contexts = nil
+			for _, kubeContext := range kubeconfigs[i].Contexts {
+				report.Clusters[i].Contexts = append(report.Clusters[i].Contexts, kubeContext.Name)
 			}
 		}
-		defer resp.Body.Close()
+	}
+
+	if len(failures) > 0 {
+		return combinedKubeconfig, report, &types.GenerateError{Failures: failures, Total: len(clusterIDs)}
+	}
+
+	return combinedKubeconfig, report, nil
+}
 
-		if resp.StatusCode != http.StatusOK {
+// selectCurrentContext sets current-context of combined to a named or the first context as chosen by opts.CurrentContext
+func selectCurrentContext(combined *types.Kubeconfig, clusterIDs []string, kubeconfigs []*types.Kubeconfig, opts Options) error {
+	switch opts.CurrentContext {
+	case types.CurrentContextFirst:
+		// contexts are already in output order (opts.Sort)
+		combined.CurrentContext = ""
+		if len(combined.Contexts) > 0 {
+			combined.CurrentContext = combined.Contexts[0].Name
+		}
+	case types.CurrentContextNamed:
+		name, ok := namedContext(opts.CurrentContextName, clusterIDs, kubeconfigs, opts.Clusters)
+		if !ok {
 			return &types.RequestError{
-				Code:    types.ErrRequestCode,
-				Message: fmt.Sprintf("Unexpected response status generating kubeconfig for cluster: %s (%v)", clusterID, resp.Status),
+				Code:    types.ErrContextNotFoundCode,
+				Message: fmt.Sprintf("current-context %q does not match a context, cluster name or cluster ID among the fetched clusters", opts.CurrentContextName),
 			}
 		}
+		combined.CurrentContext = name
+	}
+	return nil
+}
 
-		var kubeconfigResp types.KubeconfigResponse
-		if err := json.NewDecoder(resp.Body).Decode(&kubeconfigResp); err != nil {
-			return &types.RequestError{
-				Code:    types.ErrRequestCode,
-				Message: fmt.Sprintf("error decoding generate kubeconfig response for cluster: %s, error: %v", clusterID, err),
+// namedContext finds the context for name, looking for a context of that name first, then for a context of
+// the cluster entry with that name, then for the cluster with that RMS name (clusters) and finally that RMS ID
+func namedContext(name string, clusterIDs []string, kubeconfigs []*types.Kubeconfig, clusters map[string]types.RMSCluster) (string, bool) {
+	for _, kubeconfig := range kubeconfigs {
+		if kubeconfig != nil && hasContext(kubeconfig.Contexts, name) {
+			return name, true
+		}
+	}
+
+	for _, kubeconfig := range kubeconfigs {
+		if kubeconfig == nil {
+			continue
+		}
+		for _, kubeContext := range kubeconfig.Contexts {
+			if kubeContext.Context.Cluster == name {
+				return kubeContext.Name, true
 			}
 		}
+	}
 
-		var kubeconfig types.Kubeconfig
-		err = yaml.Unmarshal([]byte(kubeconfigResp.Config), &kubeconfig)
-		if err != nil {
-			return &types.RequestError{
-				Code:    types.ErrRequestCode,
-				Message: fmt.Sprintf("error unmarshaling YAML (generate kubeconfig response) for cluster: %s, error: %v", clusterID, err),
+	// a name template may have renamed the entries away from the RMS cluster name
+	for i, kubeconfig := range kubeconfigs {
+		if cluster, ok := clusters[clusterIDs[i]]; ok && cluster.Name == name {
+			if kubeContext, ok := clusterContext(kubeconfig); ok {
+				return kubeContext, true
 			}
 		}
+	}
 
-		combinedKubeconfig.Clusters = append(combinedKubeconfig.Clusters, kubeconfig.Clusters...)
-		combinedKubeconfig.Users = append(combinedKubeconfig.Users, kubeconfig.Users...)
-		combinedKubeconfig.Contexts = append(combinedKubeconfig.Contexts, kubeconfig.Contexts...)
+	for i, kubeconfig := range kubeconfigs {
+		if clusterIDs[i] == name {
+			if kubeContext, ok := clusterContext(kubeconfig); ok {
+				return kubeContext, true
+			}
+		}
 	}
 
-	err := createConfigFile(combinedKubeconfig, outputPath)
-	if err != nil {
-		return err
+	return "", false
+}
+
+// clusterContext returns the current context of the kubeconfig generated for a cluster, or its first context
+func clusterContext(kubeconfig *types.Kubeconfig) (string, bool) {
+	if kubeconfig == nil || len(kubeconfig.Contexts) == 0 {
+		return "", false
+	}
+	if kubeconfig.CurrentContext != "" && hasContext(kubeconfig.Contexts, kubeconfig.CurrentContext) {
+		return kubeconfig.CurrentContext, true
+	}
+	return kubeconfig.Contexts[0].Name, true
+}
+
+// hasContext reports whether contexts contains a context with the given name
+func hasContext(contexts []types.KubeconfigContext, name string) bool {
+	for _, kubeContext := range contexts {
+		if kubeContext.Name == name {
+			return true
+		}
 	}
+	return false
+}
 
-	return nil
+// mergeKubeconfig appends the entries of kubeconfig to combined
+// Top-level settings (current-context, preferences) are taken from the first kubeconfig that sets them
+func mergeKubeconfig(combined, kubeconfig *types.Kubeconfig) {
+	combined.Clusters = append(combined.Clusters, kubeconfig.Clusters...)
+	combined.Users = append(combined.Users, kubeconfig.Users...)
+	combined.Contexts = append(combined.Contexts, kubeconfig.Contexts...)
 
+	if combined.CurrentContext == "" {
+		combined.CurrentContext = kubeconfig.CurrentContext
+	}
+	if !combined.Preferences.Colors && len(combined.Preferences.Extensions) == 0 && len(combined.Preferences.Extra) == 0 {
+		combined.Preferences = kubeconfig.Preferences
+	}
+
+	for _, extension := range kubeconfig.Extensions {
+		if !hasExtension(combined.Extensions, extension.Name) {
+			combined.Extensions = append(combined.Extensions, extension)
+		}
+	}
+	for key, value := range kubeconfig.Extra {
+		if _, ok := combined.Extra[key]; !ok {
+			if combined.Extra == nil {
+				combined.Extra = map[string]any{}
+			}
+			combined.Extra[key] = value
+		}
+	}
+}
+
+// hasExtension reports whether extensions contains an extension with the given name
+func hasExtension(extensions []types.KubeconfigExtension, name string) bool {
+	for _, extension := range extensions {
+		if extension.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
-func createConfigFile(combinedKubeconfig *types.Kubeconfig, outputPath string) error {
-	combinedKubeconfigYaml, _ := yaml.Marshal(combinedKubeconfig)
+// asClusterRequestError returns err as a RequestError tagged with the cluster it belongs to
+func asClusterRequestError(err error, clusterID string) *types.RequestError {
+	var reqErr *types.RequestError
+	if !errors.As(err, &reqErr) {
+		reqErr = &types.RequestError{Code: types.ErrRequestCode, Message: err.Error(), Err: err}
+	}
+	reqErr.ClusterID = clusterID
+	return reqErr
+}
+
+// generateKubeconfig calls the RMS generateKubeconfig action for a single cluster
+func generateKubeconfig(ctx context.Context, opts Options, baseUrl, apiToken, clusterID string) (*types.Kubeconfig, error) {
+	actionUrl := fmt.Sprintf("%s%s%s?action=%s", baseUrl, ClusterListPath, clusterID, GenerateKubeconfigUrlAction)
+	req, err := http.NewRequestWithContext(ctx, "POST", actionUrl, nil)
+	if err != nil {
+		return nil, &types.RequestError{
+			Code:      types.ErrRequestCode,
+			Message:   fmt.Sprintf("error creating generate kubeconfig request: %v", err),
+			ClusterID: clusterID,
+			Err:       err,
+		}
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiToken)
 
-	err := os.WriteFile(outputPath+"/config", combinedKubeconfigYaml, 0644)
+	resp, err := doRequest(ctx, opts, req)
 	if err != nil {
-		return fmt.Errorf("error creating combined kubeconfig config file, error: %v", err)
+		return nil, &types.RequestError{
+			Code:      types.ErrTransportCode,
+			Message:   fmt.Sprintf("error fetching kubeconfig generate for cluster: %s, error: %v", clusterID, err),
+			Attempts:  resp.Attempts,
+			ClusterID: clusterID,
+			Err:       err,
+		}
 	}
 
-	return nil
+	if resp.StatusCode != http.StatusOK {
+		reqErr := statusError(resp, fmt.Sprintf("Unexpected response status generating kubeconfig for cluster %s", clusterID))
+		reqErr.ClusterID = clusterID
+		return nil, reqErr
+	}
+
+	var kubeconfigResp types.KubeconfigResponse
+	if err := json.Unmarshal(resp.Body, &kubeconfigResp); err != nil {
+		return nil, &types.RequestError{
+			Code:       types.ErrDecodeCode,
+			Message:    fmt.Sprintf("error decoding generate kubeconfig response for cluster: %s, error: %v", clusterID, err),
+			Attempts:   resp.Attempts,
+			ClusterID:  clusterID,
+			StatusCode: resp.StatusCode,
+			Err:        err,
+		}
+	}
+
+	var kubeconfig types.Kubeconfig
+	err = yaml.Unmarshal([]byte(kubeconfigResp.Config), &kubeconfig)
+	if err != nil {
+		return nil, &types.RequestError{
+			Code:       types.ErrInvalidKubeconfigCode,
+			Message:    fmt.Sprintf("error unmarshaling YAML (generate kubeconfig response) for cluster: %s, error: %v", clusterID, err),
+			Attempts:   resp.Attempts,
+			ClusterID:  clusterID,
+			StatusCode: resp.StatusCode,
+			Err:        err,
+		}
+	}
+
+	markManaged(&kubeconfig, baseUrl, clusterID)
+
+	return &kubeconfig, nil
 }
@@ -1,14 +1,19 @@
 package kubeconfig
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
 	yaml "gopkg.in/yaml.v3"
@@ -33,7 +38,7 @@ func TestGetClusters_Success(t *testing.T) {
 	}))
 	defer mockServer.Close()
 
-	clusters, err := GetClusters(mockServer.URL, "mockApiToken")
+	clusters, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{})
 	if err != nil {
 		t.Fatalf("expected no error, but got: %v", err)
 	}
@@ -43,6 +48,161 @@ func TestGetClusters_Success(t *testing.T) {
 	}
 
 }
+func TestGetClusters_Pagination(t *testing.T) {
+	// mock response data split across pages
+	pages := map[string][]types.RMSCluster{
+		"":      {{ID: "1", Name: "Cluster-1"}, {ID: "2", Name: "Cluster-2"}},
+		"page2": {{ID: "3", Name: "Cluster-3"}, {ID: "4", Name: "Cluster-4"}},
+		"page3": {{ID: "5", Name: "Cluster-5"}},
+	}
+	nextMarker := map[string]string{"": "page2", "page2": "page3"}
+
+	var requestedLimits []string
+
+	// mock rms-api server
+	var mockServer *httptest.Server
+	mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != ClusterListPath {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		requestedLimits = append(requestedLimits, r.URL.Query().Get("limit"))
+
+		marker := r.URL.Query().Get("marker")
+		resp := types.RMSClusterResponse{
+			Data:       pages[marker],
+			Pagination: &types.RMSPagination{Limit: 2, Total: 5},
+		}
+		if next, ok := nextMarker[marker]; ok {
+			resp.Pagination.Next = mockServer.URL + ClusterListPath + "?limit=2&marker=" + next
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer mockServer.Close()
+
+	clusters, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{PageLimit: 2})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	expectedClusters := append(append(pages[""], pages["page2"]...), pages["page3"]...)
+	if !reflect.DeepEqual(clusters, expectedClusters) {
+		t.Errorf("Expected %v, but got %v", expectedClusters, clusters)
+	}
+
+	expectedLimits := []string{"2", "2", "2"}
+	if !reflect.DeepEqual(requestedLimits, expectedLimits) {
+		t.Errorf("expected limits %v, but got %v", expectedLimits, requestedLimits)
+	}
+}
+
+func TestGetClusters_PaginationRelativeNext(t *testing.T) {
+	// mock rms-api server returning a relative next link
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := types.RMSClusterResponse{Data: []types.RMSCluster{{ID: "2", Name: "Cluster-2"}}}
+		if r.URL.Query().Get("marker") == "" {
+			resp.Data = []types.RMSCluster{{ID: "1", Name: "Cluster-1"}}
+			resp.Pagination = &types.RMSPagination{Next: ClusterListPath + "?marker=2"}
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer mockServer.Close()
+
+	clusters, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if len(clusters) != 2 {
+		t.Errorf("expected 2 clusters, but got %d", len(clusters))
+	}
+}
+
+func TestGetClusters_PaginationLoop(t *testing.T) {
+	// mock rms-api server whose next link points back to itself
+	var mockServer *httptest.Server
+	mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := types.RMSClusterResponse{
+			Data:       []types.RMSCluster{{ID: "1", Name: "Cluster-1"}},
+			Pagination: &types.RMSPagination{Next: mockServer.URL + ClusterListPath},
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer mockServer.Close()
+
+	_, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{})
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+
+	if !strings.Contains(err.Error(), "pagination loop") {
+		t.Errorf("expected pagination loop error, but got: %v", err)
+	}
+}
+
+func TestGetClusters_PaginationOffHost(t *testing.T) {
+	var offHostRequests int32
+	offHost := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&offHostRequests, 1)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.RMSClusterResponse{})
+	}))
+	defer offHost.Close()
+
+	// mock rms-api server whose next link was rewritten to another host
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := types.RMSClusterResponse{
+			Data:       []types.RMSCluster{{ID: "1", Name: "Cluster-1"}},
+			Pagination: &types.RMSPagination{Next: offHost.URL + ClusterListPath + "?marker=2"},
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer mockServer.Close()
+
+	_, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{})
+	if !errors.Is(err, types.ErrDecode) {
+		t.Fatalf("expected decode error for an off-host next link, but got: %v", err)
+	}
+	if got := atomic.LoadInt32(&offHostRequests); got != 0 {
+		t.Errorf("expected no request to the other host, got %d", got)
+	}
+}
+
+func TestGetClusters_PaginationPageError(t *testing.T) {
+	// mock rms-api server failing on the second page
+	var mockServer *httptest.Server
+	mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("marker") != "" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		resp := types.RMSClusterResponse{
+			Data:       []types.RMSCluster{{ID: "1", Name: "Cluster-1"}},
+			Pagination: &types.RMSPagination{Next: mockServer.URL + ClusterListPath + "?marker=2"},
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer mockServer.Close()
+
+	clusters, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{})
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+
+	if clusters != nil {
+		t.Errorf("expected no clusters on a partial listing, but got %v", clusters)
+	}
+
+	if !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected 503 error, but got: %v", err)
+	}
+}
+
 func TestGetClusters_Unauthorized(t *testing.T) {
 	// mock rms-api server
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -50,7 +210,7 @@ func TestGetClusters_Unauthorized(t *testing.T) {
 	}))
 	defer mockServer.Close()
 
-	_, err := GetClusters(mockServer.URL, "mockApiToken")
+	_, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{})
 	if err == nil {
 		t.Fatalf("expected error, but got nil")
 	}
@@ -61,9 +221,58 @@ func TestGetClusters_Unauthorized(t *testing.T) {
 
 }
 
+func TestGetClusters_StatusErrorTaxonomy(t *testing.T) {
+	tests := []struct {
+		status   int
+		code     int
+		sentinel error
+	}{
+		{http.StatusUnauthorized, types.ErrUnauthorizedCode, types.ErrUnauthorized},
+		{http.StatusForbidden, types.ErrForbiddenCode, types.ErrForbidden},
+		{http.StatusNotFound, types.ErrNotFoundCode, types.ErrNotFound},
+		{http.StatusInternalServerError, types.ErrStatusCode, types.ErrStatus},
+	}
+
+	for _, test := range tests {
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+		}))
+
+		_, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{})
+		mockServer.Close()
+
+		var reqErr *types.RequestError
+		if !errors.As(err, &reqErr) {
+			t.Fatalf("expected custom RequestError, but got: %T", err)
+		}
+		if reqErr.Code != test.code || reqErr.StatusCode != test.status {
+			t.Errorf("status %d: expected code %d, got code %d (status %d)", test.status, test.code, reqErr.Code, reqErr.StatusCode)
+		}
+		if !errors.Is(err, test.sentinel) {
+			t.Errorf("status %d: expected errors.Is to match %v", test.status, test.sentinel)
+		}
+		if errors.Is(err, types.ErrTransport) {
+			t.Errorf("status %d: expected errors.Is not to match %v", test.status, types.ErrTransport)
+		}
+	}
+}
+
+func TestGetClusters_TransportErrorUnwrap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := GetClusters(ctx, "http://rms.test", "mockApiToken", Options{})
+	if !errors.Is(err, types.ErrTransport) {
+		t.Errorf("expected transport error, but got: %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected errors.Is to reach the wrapped context error, but got: %v", err)
+	}
+}
+
 func TestGetClusters_DoRequestErrorNoHost(t *testing.T) {
 	// invalid host (i.e., no host in URL)
-	_, err := GetClusters("http://", "mockApiToken")
+	_, err := GetClusters(context.Background(), "http://", "mockApiToken", Options{})
 	if err == nil {
 		t.Fatalf("expected error, but got nil")
 	}
@@ -73,15 +282,15 @@ func TestGetClusters_DoRequestErrorNoHost(t *testing.T) {
 		t.Fatalf("expected custom RequestError, but got: %T", err)
 	}
 
-	if reqErr.Code != types.ErrRequestCode {
-		t.Errorf("expected error code %d, but got: %d", types.ErrRequestCode, reqErr.Code)
+	if reqErr.Code != types.ErrTransportCode {
+		t.Errorf("expected error code %d, but got: %d", types.ErrTransportCode, reqErr.Code)
 	}
 
 }
 
 func TestGetClusters_NewRequestInvalidScheme(t *testing.T) {
 	// missing protocol scheme (i.e., missing http/https)
-	_, err := GetClusters("://missing-scheme", "mockApiToken")
+	_, err := GetClusters(context.Background(), "://missing-scheme", "mockApiToken", Options{})
 	if err == nil {
 		t.Fatalf("expected error, but got nil")
 	}
@@ -104,7 +313,7 @@ func TestGetClusters_StatusNotFound(t *testing.T) {
 	}))
 	defer mockServer.Close()
 
-	_, err := GetClusters(mockServer.URL, "mockApiToken")
+	_, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{})
 	if err == nil {
 		t.Fatalf("expected error, but got nil")
 	}
@@ -124,7 +333,7 @@ func TestGetClusters_ErrorDecodingResponse(t *testing.T) {
 	}))
 	defer mockServer.Close()
 
-	_, err := GetClusters(mockServer.URL, "mockApiToken")
+	_, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{})
 	if err == nil {
 		t.Fatalf("expected error, but got nil")
 	}
@@ -134,8 +343,8 @@ func TestGetClusters_ErrorDecodingResponse(t *testing.T) {
 		t.Fatalf("expected custom RequestError, but got: %T", err)
 	}
 
-	if reqErr.Code != types.ErrRequestCode {
-		t.Errorf("Expected error code %d, but got: %d", types.ErrRequestCode, reqErr.Code)
+	if reqErr.Code != types.ErrDecodeCode {
+		t.Errorf("Expected error code %d, but got: %d", types.ErrDecodeCode, reqErr.Code)
 	}
 
 }
@@ -206,7 +415,7 @@ contexts:
 	}
 	defer os.RemoveAll(tempDir)
 
-	err = GenerateCombinedKubeconfig(mockServer.URL, "mock-token", tempDir, []string{"cluster1", "cluster2"})
+	_, err = GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"cluster1", "cluster2"}, Options{})
 	if err != nil {
 		t.Fatalf("Function returned an error: %v", err)
 	}
@@ -236,6 +445,443 @@ contexts:
 	}
 }
 
+func TestGenerateCombinedKubeconfig_ConcurrentStableOrder(t *testing.T) {
+	clusterIDs := []string{"c1", "c2", "c3", "c4", "c5", "c6"}
+	concurrency := 3
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	// mock rms-api server, earlier clusters respond slower than later ones
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+
+		clusterID := strings.TrimPrefix(r.URL.Path, ClusterListPath)
+		delay := time.Duration(len(clusterIDs)-int(clusterID[1]-'0')) * 10 * time.Millisecond
+		time.Sleep(delay)
+
+		config := fmt.Sprintf(`
+clusters:
+- name: %[1]s
+  cluster:
+    server: https://%[1]s.test
+users:
+- name: %[1]s
+  user:
+    token: token
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s`, clusterID)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: config})
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, clusterIDs, Options{Concurrency: concurrency})
+	if err != nil {
+		t.Fatalf("Function returned an error: %v", err)
+	}
+
+	if maxInFlight > concurrency {
+		t.Errorf("expected at most %d requests in flight, got %d", concurrency, maxInFlight)
+	}
+	if maxInFlight < 2 {
+		t.Errorf("expected requests to run concurrently, max in flight was %d", maxInFlight)
+	}
+
+	output, err := os.ReadFile(tempDir + "/config")
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	var combinedKubeconfig types.Kubeconfig
+	if err := yaml.Unmarshal(output, &combinedKubeconfig); err != nil {
+		t.Fatalf("Failed to unmarshal combined kubeconfig: %v", err)
+	}
+
+	if len(combinedKubeconfig.Contexts) != len(clusterIDs) {
+		t.Fatalf("expected %d contexts, got %d", len(clusterIDs), len(combinedKubeconfig.Contexts))
+	}
+	for i, clusterID := range clusterIDs {
+		if combinedKubeconfig.Clusters[i].Name != clusterID {
+			t.Errorf("expected cluster %d to be %q, got %q", i, clusterID, combinedKubeconfig.Clusters[i].Name)
+		}
+		if combinedKubeconfig.Contexts[i].Name != clusterID {
+			t.Errorf("expected context %d to be %q, got %q", i, clusterID, combinedKubeconfig.Contexts[i].Name)
+		}
+	}
+}
+
+func TestGenerateCombinedKubeconfig_ConcurrentError(t *testing.T) {
+	// mock rms-api server failing a single cluster
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, ClusterListPath) == "bad" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: "clusters: []"})
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"ok1", "bad", "ok2"}, Options{Concurrency: 2})
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+
+	if !strings.Contains(err.Error(), "bad") {
+		t.Errorf("expected error to name the failing cluster, got: %v", err)
+	}
+
+	if _, err := os.Stat(tempDir + "/config"); !os.IsNotExist(err) {
+		t.Errorf("expected no config file to be written, stat error: %v", err)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_FailFastCancelsInFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+
+	// mock rms-api server failing one cluster while the other is still generating
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, ClusterListPath) == "bad" {
+			<-started
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		close(started)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			close(cancelled)
+		}
+	}))
+	defer mockServer.Close()
+	defer close(release)
+
+	report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", t.TempDir(), []string{"slow", "bad"}, Options{Concurrency: 2})
+	if !errors.Is(err, types.ErrNotFound) {
+		t.Fatalf("expected the failure of bad, but got: %v", err)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the request in flight to be cancelled")
+	}
+
+	if report.Clusters[0].Status != types.ClusterSkipped || report.Clusters[0].Err != nil {
+		t.Errorf("expected the cancelled cluster to be skipped, got %+v", report.Clusters[0])
+	}
+	if report.Clusters[1].Status != types.ClusterFailed {
+		t.Errorf("expected bad to be failed, got %q", report.Clusters[1].Status)
+	}
+}
+
+func TestGetClusters_RequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+
+	// mock rms-api server that hangs until the test finishes
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer mockServer.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{RequestTimeout: 50 * time.Millisecond})
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+
+	if !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("expected deadline exceeded error, but got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected request to time out quickly, took %v", elapsed)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_ContextCancelled(t *testing.T) {
+	var requests int32
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// mock rms-api server that cancels the run on the first request
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	_, err := GenerateCombinedKubeconfig(ctx, mockServer.URL, "mock-token", tempDir, []string{"c1", "c2", "c3", "c4"}, Options{})
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+
+	var reqErr *types.RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("expected custom RequestError, but got: %T", err)
+	}
+
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("expected no requests after cancellation, got %d", got)
+	}
+
+	if _, err := os.Stat(tempDir + "/config"); !os.IsNotExist(err) {
+		t.Errorf("expected no config file to be written, stat error: %v", err)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_ContinueOnError(t *testing.T) {
+	// mock rms-api server failing two of four clusters
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clusterID := strings.TrimPrefix(r.URL.Path, ClusterListPath)
+		switch clusterID {
+		case "disconnected":
+			http.Error(w, "cluster unavailable", http.StatusServiceUnavailable)
+		case "missing":
+			http.Error(w, "cluster not found", http.StatusNotFound)
+		default:
+			config := fmt.Sprintf(`
+clusters:
+- name: %[1]s
+  cluster:
+    server: https://%[1]s.test
+users:
+- name: %[1]s
+  user:
+    token: token
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s`, clusterID)
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: config})
+		}
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	clusterIDs := []string{"ok1", "disconnected", "ok2", "missing"}
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, clusterIDs, Options{Concurrency: 2, ContinueOnError: true})
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+
+	var genErr *types.GenerateError
+	if !errors.As(err, &genErr) {
+		t.Fatalf("expected GenerateError, but got: %T", err)
+	}
+
+	if len(genErr.Failures) != 2 || genErr.Total != 4 {
+		t.Fatalf("expected 2 of 4 failures, got %d of %d", len(genErr.Failures), genErr.Total)
+	}
+	expectedFailures := []struct {
+		clusterID  string
+		statusCode int
+	}{{"disconnected", http.StatusServiceUnavailable}, {"missing", http.StatusNotFound}}
+	for i, expected := range expectedFailures {
+		if genErr.Failures[i].ClusterID != expected.clusterID || genErr.Failures[i].StatusCode != expected.statusCode {
+			t.Errorf("expected failure %d for %s (%d), got %s (%d)", i, expected.clusterID, expected.statusCode, genErr.Failures[i].ClusterID, genErr.Failures[i].StatusCode)
+		}
+	}
+
+	var reqErr *types.RequestError
+	if !errors.As(err, &reqErr) || reqErr.ClusterID != "disconnected" {
+		t.Errorf("expected errors.As to reach the first failed cluster, got: %v", reqErr)
+	}
+
+	output, err := os.ReadFile(tempDir + "/config")
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	var combinedKubeconfig types.Kubeconfig
+	if err := yaml.Unmarshal(output, &combinedKubeconfig); err != nil {
+		t.Fatalf("Failed to unmarshal combined kubeconfig: %v", err)
+	}
+
+	if len(combinedKubeconfig.Contexts) != 2 || combinedKubeconfig.Contexts[0].Name != "ok1" || combinedKubeconfig.Contexts[1].Name != "ok2" {
+		t.Errorf("expected contexts for ok1 and ok2, got %+v", combinedKubeconfig.Contexts)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_ContinueOnErrorAllFailed(t *testing.T) {
+	// mock rms-api server failing every cluster
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "cluster not found", http.StatusNotFound)
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c1", "c2"}, Options{ContinueOnError: true})
+
+	var genErr *types.GenerateError
+	if !errors.As(err, &genErr) {
+		t.Fatalf("expected GenerateError, but got: %v", err)
+	}
+	if len(genErr.Failures) != 2 {
+		t.Errorf("expected 2 failures, got %d", len(genErr.Failures))
+	}
+
+	if _, err := os.Stat(tempDir + "/config"); !os.IsNotExist(err) {
+		t.Errorf("expected no config file to be written, stat error: %v", err)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_ReportFailFast(t *testing.T) {
+	// mock rms-api server failing the second cluster
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, ClusterListPath) == "bad" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: "contexts:\n- name: ok"})
+	}))
+	defer mockServer.Close()
+
+	report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", t.TempDir(), []string{"ok", "bad", "later"}, Options{})
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+
+	expectedStatuses := []types.ClusterStatus{types.ClusterSkipped, types.ClusterFailed, types.ClusterSkipped}
+	for i, expected := range expectedStatuses {
+		if report.Clusters[i].Status != expected {
+			t.Errorf("expected cluster %d status %q, got %q", i, expected, report.Clusters[i].Status)
+		}
+	}
+
+	if report.OutputFile != "" {
+		t.Errorf("expected no output file, got %q", report.OutputFile)
+	}
+	if !reflect.DeepEqual(report.Clusters[0].Contexts, []string{"ok"}) {
+		t.Errorf("expected generated contexts to be reported, got %v", report.Clusters[0].Contexts)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_PreservesFullSchema(t *testing.T) {
+	// kubeconfig using fields beyond server/token, plus a key unknown to the schema
+	mockKubeconfigResponse := types.KubeconfigResponse{
+		Config: `
+apiVersion: v1
+kind: Config
+current-context: full
+preferences:
+  colors: true
+clusters:
+- name: full
+  cluster:
+    server: https://full.test
+    certificate-authority-data: Y2EtZGF0YQ==
+    tls-server-name: full.internal
+    proxy-url: http://proxy.test:3128
+    insecure-skip-tls-verify: true
+    extensions:
+    - name: rms
+      extension:
+        clusterID: c-full
+    future-field: kept
+users:
+- name: full
+  user:
+    client-certificate-data: Y2VydA==
+    client-key-data: a2V5
+    exec:
+      apiVersion: client.authentication.k8s.io/v1
+      command: rancher
+      args: [token, --server, full.test]
+      env:
+      - name: RANCHER_ENV
+        value: prod
+      interactiveMode: Never
+contexts:
+- name: full
+  context:
+    cluster: full
+    user: full
+    namespace: payments
+extensions:
+- name: top
+  extension:
+    owner: rms`,
+	}
+
+	// mock rms-api server
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(mockKubeconfigResponse)
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"full"}, Options{})
+	if err != nil {
+		t.Fatalf("Function returned an error: %v", err)
+	}
+
+	output, err := os.ReadFile(tempDir + "/config")
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	var combinedKubeconfig types.Kubeconfig
+	if err := yaml.Unmarshal(output, &combinedKubeconfig); err != nil {
+		t.Fatalf("Failed to unmarshal combined kubeconfig: %v", err)
+	}
+
+	cluster := combinedKubeconfig.Clusters[0].Cluster
+	if cluster.TLSServerName != "full.internal" || cluster.ProxyURL != "http://proxy.test:3128" || !cluster.InsecureSkipTLSVerify {
+		t.Errorf("expected cluster TLS and proxy settings to be preserved, got %+v", cluster)
+	}
+	if len(cluster.Extensions) == 0 || cluster.Extensions[0].Name != "rms" {
+		t.Errorf("expected cluster extensions to be preserved, got %+v", cluster.Extensions)
+	}
+	if cluster.Extra["future-field"] != "kept" {
+		t.Errorf("expected unknown cluster field to be preserved, got %+v", cluster.Extra)
+	}
+
+	user := combinedKubeconfig.Users[0].User
+	if user.ClientCertificateData != "Y2VydA==" || user.ClientKeyData != "a2V5" {
+		t.Errorf("expected client certificate and key to be preserved, got %+v", user)
+	}
+	if user.Exec == nil || user.Exec.Command != "rancher" || len(user.Exec.Args) != 3 || user.Exec.Env[0].Value != "prod" {
+		t.Errorf("expected exec config to be preserved, got %+v", user.Exec)
+	}
+
+	if combinedKubeconfig.Contexts[0].Context.Namespace != "payments" {
+		t.Errorf("expected context namespace to be preserved, got %q", combinedKubeconfig.Contexts[0].Context.Namespace)
+	}
+	if combinedKubeconfig.CurrentContext != "full" || !combinedKubeconfig.Preferences.Colors {
+		t.Errorf("expected current-context and preferences to be preserved, got %q / %+v", combinedKubeconfig.CurrentContext, combinedKubeconfig.Preferences)
+	}
+	if len(combinedKubeconfig.Extensions) != 1 || combinedKubeconfig.Extensions[0].Name != "top" {
+		t.Errorf("expected top-level extensions to be preserved, got %+v", combinedKubeconfig.Extensions)
+	}
+}
+
 func TestGenerateCombinedKubeconfig_ClusterNotFound(t *testing.T) {
 	// mock rms-api server - kubeconfig response
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -246,7 +892,7 @@ func TestGenerateCombinedKubeconfig_ClusterNotFound(t *testing.T) {
 	}))
 	defer mockServer.Close()
 
-	err := GenerateCombinedKubeconfig(mockServer.URL, "mock-token", "", []string{"cluster-does-not-exist"})
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", "", []string{"cluster-does-not-exist"}, Options{})
 	if err == nil {
 		t.Fatalf("expected error, but got nil")
 	}
@@ -263,7 +909,7 @@ func TestGenerateCombinedKubeconfig_ClusterNotFound(t *testing.T) {
 
 func TestGenerateCombinedKubeconfig_NewRequestInvalidScheme(t *testing.T) {
 	// missing protocol scheme (i.e., missing http/https)
-	err := GenerateCombinedKubeconfig("://missing-scheme", "mock-token", "", []string{"cluster-does-not-exist"})
+	_, err := GenerateCombinedKubeconfig(context.Background(), "://missing-scheme", "mock-token", "", []string{"cluster-does-not-exist"}, Options{})
 
 	if err == nil {
 		t.Fatalf("expected error, but got nil")
@@ -282,7 +928,7 @@ func TestGenerateCombinedKubeconfig_NewRequestInvalidScheme(t *testing.T) {
 
 func TestGenerateCombinedKubeconfig_DoRequestErrorNoHost(t *testing.T) {
 	// invalid host (i.e., no host in URL)
-	err := GenerateCombinedKubeconfig("https://", "mock-token", "", []string{"cluster-does-not-exist"})
+	_, err := GenerateCombinedKubeconfig(context.Background(), "https://", "mock-token", "", []string{"cluster-does-not-exist"}, Options{})
 	if err == nil {
 		t.Fatalf("expected error, but got nil")
 	}
@@ -292,8 +938,8 @@ func TestGenerateCombinedKubeconfig_DoRequestErrorNoHost(t *testing.T) {
 		t.Fatalf("expected custom RequestError, but got: %T", err)
 	}
 
-	if reqErr.Code != types.ErrRequestCode {
-		t.Errorf("expected error code %d, but got: %d", types.ErrRequestCode, reqErr.Code)
+	if reqErr.Code != types.ErrTransportCode {
+		t.Errorf("expected error code %d, but got: %d", types.ErrTransportCode, reqErr.Code)
 	}
 }
 
@@ -306,7 +952,7 @@ func TestGenerateCombinedKubeconfig_ErrorDecodingResponse(t *testing.T) {
 	}))
 	defer mockServer.Close()
 
-	err := GenerateCombinedKubeconfig(mockServer.URL, "mock-token", "", []string{"test-cluster"})
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", "", []string{"test-cluster"}, Options{})
 	if err == nil {
 		t.Fatalf("expected error, but got nil")
 	}
@@ -316,8 +962,8 @@ func TestGenerateCombinedKubeconfig_ErrorDecodingResponse(t *testing.T) {
 		t.Fatalf("expected custom RequestError, but got: %T", err)
 	}
 
-	if reqErr.Code != types.ErrRequestCode {
-		t.Errorf("Expected error code %d, but got: %d", types.ErrRequestCode, reqErr.Code)
+	if reqErr.Code != types.ErrDecodeCode {
+		t.Errorf("Expected error code %d, but got: %d", types.ErrDecodeCode, reqErr.Code)
 	}
 }
 
@@ -333,7 +979,7 @@ func TestGenerateCombinedKubeconfig_MalformedYaml(t *testing.T) {
 	}))
 	defer mockServer.Close()
 
-	err := GenerateCombinedKubeconfig(mockServer.URL, "mock-token", "", []string{"test-cluster"})
+	_, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", "", []string{"test-cluster"}, Options{})
 	if err == nil {
 		t.Fatalf("expected error, but got nil")
 	}
@@ -343,27 +989,31 @@ func TestGenerateCombinedKubeconfig_MalformedYaml(t *testing.T) {
 		t.Fatalf("expected custom RequestError, but got: %T", err)
 	}
 
-	if reqErr.Code != types.ErrRequestCode {
-		t.Errorf("Expected error code %d, but got: %d", types.ErrRequestCode, reqErr.Code)
+	if reqErr.Code != types.ErrInvalidKubeconfigCode {
+		t.Errorf("Expected error code %d, but got: %d", types.ErrInvalidKubeconfigCode, reqErr.Code)
 	}
 }
 
-func TestCreateConfigFile_InvalidFilePath(t *testing.T) {
+func TestSaveKubeconfig_InvalidFilePath(t *testing.T) {
 	var kubeconfig *types.Kubeconfig
 	invalidOutputPath := t.TempDir() + "/invalid/path/"
 	expectedError := "no such file or directory"
 
-	err := createConfigFile(kubeconfig, invalidOutputPath)
+	_, err := saveKubeconfig(context.Background(), kubeconfig, invalidOutputPath, Options{}.withDefaults())
 	if err != nil && !strings.Contains(err.Error(), expectedError) {
 		t.Errorf("expected error message to contain %q, but got: %v", expectedError, err)
 	}
 
+	if !errors.Is(err, types.ErrWrite) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected write error wrapping os.ErrNotExist, but got: %v", err)
+	}
+
 	if err == nil {
 		t.Fatalf("expected error, but got: %v", err)
 	}
 }
 
-func TestCreateConfigFile_Success(t *testing.T) {
+func TestSaveKubeconfig_Success(t *testing.T) {
 	tempDir := t.TempDir()
 
 	combinedKubeconfig := types.Kubeconfig{
@@ -376,7 +1026,7 @@ func TestCreateConfigFile_Success(t *testing.T) {
 		},
 	}
 
-	err := createConfigFile(&combinedKubeconfig, tempDir)
+	_, err := saveKubeconfig(context.Background(), &combinedKubeconfig, tempDir, Options{}.withDefaults())
 	if err != nil {
 		t.Fatalf("expected no error, but got: %v", err)
 	}
@@ -393,7 +1043,6 @@ clusters:
     - name: test-cluster
       cluster:
         server: https://test.local
-        certificate-authority-data: ""
 users: []
 contexts: []
 `
@@ -401,3 +1050,224 @@ contexts: []
 		t.Errorf("unexpected file content. Got:\n%v\nExpected:\n%v", string(fileData), expectedCombinedKubeconfigContent)
 	}
 }
+
+func TestBuildCombinedKubeconfig(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "prod", "c-dev": "dev"})
+	defer mockServer.Close()
+
+	combined, report, err := BuildCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", []string{"c-prod", "c-dev"}, Options{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if names := clusterNames(*combined); !reflect.DeepEqual(names, []string{"dev", "prod"}) {
+		t.Errorf("expected clusters [dev prod], got %v", names)
+	}
+	if report.OutputFile != "" {
+		t.Errorf("expected no output file for an in-memory build, got %s", report.OutputFile)
+	}
+	for _, cluster := range report.Clusters {
+		if cluster.Status != types.ClusterIncluded {
+			t.Errorf("expected cluster %s to be included, got %s", cluster.ClusterID, cluster.Status)
+		}
+	}
+}
+
+func TestBuildCombinedKubeconfig_ContinueOnErrorPartial(t *testing.T) {
+	// mock rms-api server failing one cluster
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/bad") {
+			http.Error(w, "cluster not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: "clusters:\n- name: good\n  cluster:\n    server: https://good.test"})
+	}))
+	defer mockServer.Close()
+
+	combined, _, err := BuildCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", []string{"good", "bad"}, Options{ContinueOnError: true})
+
+	var genErr *types.GenerateError
+	if !errors.As(err, &genErr) {
+		t.Fatalf("expected GenerateError, but got: %v", err)
+	}
+	if combined == nil || len(combined.Clusters) != 1 || combined.Clusters[0].Name != "good" {
+		t.Errorf("expected a partial kubeconfig with the good cluster, got %+v", combined)
+	}
+
+	combined, _, err = BuildCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", []string{"good", "bad"}, Options{})
+	if err == nil || combined != nil {
+		t.Errorf("expected fail-fast build to return no kubeconfig, got %+v, %v", combined, err)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_CurrentContext(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "prod", "c-dev": "dev"})
+	defer mockServer.Close()
+
+	clusterIDs := []string{"c-prod", "c-dev"}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{"default", Options{}, ""},
+		{"named context", Options{CurrentContext: types.CurrentContextNamed, CurrentContextName: "dev"}, "dev"},
+		{"named cluster ID", Options{CurrentContext: types.CurrentContextNamed, CurrentContextName: "c-dev"}, "dev"},
+		{"first sorted", Options{CurrentContext: types.CurrentContextFirst}, "dev"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			if _, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, clusterIDs, test.opts); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if got := readKubeconfig(t, tempDir+"/config").CurrentContext; got != test.expected {
+				t.Errorf("expected current-context %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenerateCombinedKubeconfig_CurrentContextDefault(t *testing.T) {
+	// mock rms-api server returning kubeconfigs with current-context set, as Rancher does
+	names := map[string]string{"c-prod": "prod", "c-dev": "dev"}
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := names[strings.TrimPrefix(r.URL.Path, ClusterListPath)]
+		config := fmt.Sprintf(`
+clusters:
+- name: %[1]s
+  cluster:
+    server: https://%[1]s.test
+users:
+- name: %[1]s
+  user:
+    token: new-token
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s
+current-context: %[1]s`, name)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: config})
+	}))
+	defer mockServer.Close()
+
+	clusterIDs := []string{"c-prod", "c-dev"}
+
+	tests := []struct {
+		name     string
+		existing string
+		opts     Options
+		expected string
+	}{
+		{"first by cluster ID", "", Options{}, "dev"},
+		{"first in RMS order", "", Options{Sort: types.SortNone}, "prod"},
+		{"kept when merging", fmt.Sprintf(existingKubeconfig, mockServer.URL), Options{Merge: true}, "kind-dev"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			if test.existing != "" {
+				if err := os.WriteFile(tempDir+"/config", []byte(test.existing), 0600); err != nil {
+					t.Fatalf("failed to write existing config: %v", err)
+				}
+			}
+			if _, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, clusterIDs, test.opts); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if got := readKubeconfig(t, tempDir+"/config").CurrentContext; got != test.expected {
+				t.Errorf("expected current-context %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenerateCombinedKubeconfig_CurrentContextNotFound(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "prod"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	opts := Options{CurrentContext: types.CurrentContextNamed, CurrentContextName: "staging"}
+	report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-prod"}, opts)
+
+	if !errors.Is(err, types.ErrContextNotFound) {
+		t.Fatalf("expected ErrContextNotFound, but got: %v", err)
+	}
+	if !strings.Contains(err.Error(), `"staging"`) {
+		t.Errorf("expected error to name the missing context, got: %v", err)
+	}
+	if _, err := os.Stat(tempDir + "/config"); err == nil {
+		t.Errorf("expected no output file to be written")
+	}
+	if report.Clusters[0].Status != types.ClusterSkipped {
+		t.Errorf("expected cluster to be skipped, got %s", report.Clusters[0].Status)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_CurrentContextMerge(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "prod", "c-dev": "dev"})
+	defer mockServer.Close()
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{"default keeps existing", Options{Merge: true}, "kind-dev"},
+		{"keep", Options{Merge: true, CurrentContext: types.CurrentContextKeep}, "kind-dev"},
+		{"named overrides existing", Options{Merge: true, CurrentContext: types.CurrentContextNamed, CurrentContextName: "prod"}, "prod"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			if err := os.WriteFile(tempDir+"/config", []byte(fmt.Sprintf(existingKubeconfig, mockServer.URL)), 0600); err != nil {
+				t.Fatalf("failed to write existing config: %v", err)
+			}
+
+			if _, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-prod", "c-dev"}, test.opts); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if got := readKubeconfig(t, tempDir+"/config").CurrentContext; got != test.expected {
+				t.Errorf("expected current-context %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenerateCombinedKubeconfig_CurrentContextKeepWithoutMerge(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "prod", "c-dev": "dev"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	clusterIDs := []string{"c-prod", "c-dev"}
+
+	named := Options{CurrentContext: types.CurrentContextNamed, CurrentContextName: "dev"}
+	if _, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, clusterIDs, named); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	keep := Options{CurrentContext: types.CurrentContextKeep}
+	if _, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, clusterIDs, keep); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if got := readKubeconfig(t, tempDir+"/config").CurrentContext; got != "dev" {
+		t.Errorf("expected previous current-context dev to be kept, got %q", got)
+	}
+
+	// the previous context is gone, nothing to keep
+	if _, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-prod"}, keep); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if got := readKubeconfig(t, tempDir+"/config").CurrentContext; got != "" {
+		t.Errorf("expected no current-context once dev is gone, got %q", got)
+	}
+}
@@ -0,0 +1,80 @@
+package kubeconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// lockSuffix names the sidecar file locked while a kubeconfig is read, merged and written
+// kubectl owns `<file>.lock` (created exclusively and removed after each edit), so the sidecar must not use it
+const lockSuffix = ".rmskubeconfig.lock"
+
+// lockPollInterval is how often a lock held by another run is retried
+var lockPollInterval = 50 * time.Millisecond
+
+// lockConfigFile takes an exclusive advisory lock on the sidecar of configPath, waiting up to opts.LockTimeout
+// or until ctx is done. The returned func releases the lock. The sidecar is left in place so every run keeps
+// locking the same file
+func lockConfigFile(ctx context.Context, configPath string, opts Options) (func(), error) {
+	lockPath := lockFilePath(configPath)
+
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, DefaultFileMode)
+	if err != nil {
+		return nil, &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("error opening lock file %s, error: %v", lockPath, err),
+			Err:     err,
+		}
+	}
+
+	timeout := time.NewTimer(opts.LockTimeout)
+	defer timeout.Stop()
+
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, &types.RequestError{
+				Code:    types.ErrWriteCode,
+				Message: fmt.Sprintf("error locking %s, error: %v", lockPath, err),
+				Err:     err,
+			}
+		}
+		if locked {
+			return func() {
+				unlockFile(f)
+				f.Close()
+			}, nil
+		}
+
+		poll := time.NewTimer(lockPollInterval)
+		select {
+		case <-poll.C:
+		case <-timeout.C:
+			poll.Stop()
+			f.Close()
+			return nil, &types.RequestError{
+				Code:    types.ErrLockedCode,
+				Message: fmt.Sprintf("timed out after %v waiting for %s, another rmskubeconfig run is writing %s", opts.LockTimeout, lockPath, configPath),
+			}
+		case <-ctx.Done():
+			poll.Stop()
+			f.Close()
+			return nil, &types.RequestError{
+				Code:    types.ErrLockedCode,
+				Message: fmt.Sprintf("stopped waiting for %s: %v", lockPath, ctx.Err()),
+				Err:     ctx.Err(),
+			}
+		}
+	}
+}
+
+// lockFilePath returns the hidden sidecar `.<file>.rmskubeconfig.lock` next to configPath
+func lockFilePath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "."+filepath.Base(configPath)+lockSuffix)
+}
@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package kubeconfig
+
+import "os"
+
+// tryLockFile is a no-op where neither flock nor LockFileEx is available, concurrent runs are not serialized
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+// unlockFile is a no-op where neither flock nor LockFileEx is available
+func unlockFile(f *os.File) error {
+	return nil
+}
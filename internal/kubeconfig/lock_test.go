@@ -0,0 +1,178 @@
+//go:build unix
+
+package kubeconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+func TestLockConfigFile_Timeout(t *testing.T) {
+	configPath := t.TempDir() + "/config"
+	opts := Options{LockTimeout: 100 * time.Millisecond}.withDefaults()
+
+	unlock, err := lockConfigFile(context.Background(), configPath, opts)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	start := time.Now()
+	_, err = lockConfigFile(context.Background(), configPath, opts)
+	if !errors.Is(err, types.ErrLocked) {
+		t.Fatalf("expected ErrLocked while the lock is held, but got: %v", err)
+	}
+	if waited := time.Since(start); waited < opts.LockTimeout {
+		t.Errorf("expected to wait %v for the lock, gave up after %v", opts.LockTimeout, waited)
+	}
+
+	unlock()
+
+	unlock, err = lockConfigFile(context.Background(), configPath, opts)
+	if err != nil {
+		t.Fatalf("expected lock to be free after release, but got: %v", err)
+	}
+	unlock()
+}
+
+func TestLockConfigFile_WaitsForRelease(t *testing.T) {
+	configPath := t.TempDir() + "/config"
+	opts := Options{LockTimeout: 5 * time.Second}.withDefaults()
+
+	unlock, err := lockConfigFile(context.Background(), configPath, opts)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	time.AfterFunc(100*time.Millisecond, unlock)
+
+	unlock, err = lockConfigFile(context.Background(), configPath, opts)
+	if err != nil {
+		t.Fatalf("expected to acquire the lock once released, but got: %v", err)
+	}
+	unlock()
+}
+
+func TestLockConfigFile_Cancelled(t *testing.T) {
+	configPath := t.TempDir() + "/config"
+	opts := Options{LockTimeout: time.Minute}.withDefaults()
+
+	unlock, err := lockConfigFile(context.Background(), configPath, opts)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = lockConfigFile(ctx, configPath, opts)
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, types.ErrLocked) {
+		t.Fatalf("expected a lock error wrapping the context deadline, but got: %v", err)
+	}
+	if waited := time.Since(start); waited > 5*time.Second {
+		t.Errorf("expected the wait to end with the context, gave up after %v", waited)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_ConcurrentRuns(t *testing.T) {
+	const runs = 8
+	names := make(map[string]string, runs)
+	for i := 0; i < runs; i++ {
+		names[fmt.Sprintf("c-%d", i)] = fmt.Sprintf("run-%d", i)
+	}
+	mockServer := mockRMSServer(t, names)
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+
+	// every run merges its own cluster, without the lock a run would overwrite the entries merged by another
+	var wg sync.WaitGroup
+	errs := make([]error, runs)
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clusterIDs := []string{fmt.Sprintf("c-%d", i)}
+			_, errs[i] = GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, clusterIDs, Options{Merge: true, Backups: 2})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("run %d expected no error, but got: %v", i, err)
+		}
+	}
+
+	kubeconfig := readKubeconfig(t, tempDir+"/config")
+	got := clusterNames(kubeconfig)
+	sort.Strings(got)
+	var expected []string
+	for _, name := range names {
+		expected = append(expected, name)
+	}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the clusters of every run %v, got %v", expected, got)
+	}
+	if len(kubeconfig.Users) != runs || len(kubeconfig.Contexts) != runs {
+		t.Errorf("expected %d users and %d contexts, got %d and %d", runs, runs, len(kubeconfig.Users), len(kubeconfig.Contexts))
+	}
+	if _, err := os.Stat(tempDir + "/.config.rmskubeconfig.lock"); err != nil {
+		t.Errorf("expected lock sidecar to exist, error: %v", err)
+	}
+	// kubectl creates config.lock exclusively while editing, a leftover would make it fail
+	if _, err := os.Stat(tempDir + "/config.lock"); err == nil {
+		t.Errorf("expected kubectl's config.lock not to be created")
+	}
+	assertNoTempFiles(t, tempDir)
+}
+
+func TestGenerateCombinedKubeconfig_LockThroughSymlink(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "prod"})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	dotfiles := tempDir + "/dotfiles"
+	kubeDir := tempDir + "/kube"
+	for _, dir := range []string{dotfiles, kubeDir} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.Symlink("../dotfiles/config", kubeDir+"/config"); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	// another run holds the lock of the real path
+	opts := Options{LockTimeout: 100 * time.Millisecond}
+	unlock, err := lockConfigFile(context.Background(), dotfiles+"/config", opts.withDefaults())
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	_, err = GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", kubeDir, []string{"c-prod"}, opts)
+	if !errors.Is(err, types.ErrLocked) {
+		t.Fatalf("expected a run through the symlink to wait for the same lock, but got: %v", err)
+	}
+	unlock()
+
+	if _, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", kubeDir, []string{"c-prod"}, opts); err != nil {
+		t.Fatalf("expected no error once the lock is released, but got: %v", err)
+	}
+	if _, err := os.Stat(kubeDir + "/.config.rmskubeconfig.lock"); err == nil {
+		t.Errorf("expected no lock sidecar next to the symlink")
+	}
+	if info, err := os.Lstat(kubeDir + "/config"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected the symlink to be kept, error: %v", err)
+	}
+}
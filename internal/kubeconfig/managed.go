@@ -0,0 +1,81 @@
+package kubeconfig
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// ManagedExtensionName names the extension marking kubeconfig entries written by rmskubeconfig
+const ManagedExtensionName string = "rmskubeconfig"
+
+// markManaged tags every cluster, user and context of kubeconfig as generated for clusterID by the RMS at rmsUrl
+func markManaged(kubeconfig *types.Kubeconfig, rmsUrl, clusterID string) {
+	marker := types.KubeconfigExtension{
+		Name:      ManagedExtensionName,
+		Extension: types.ManagedMarker{RMSUrl: normalizeRMSUrl(rmsUrl), ClusterID: clusterID},
+	}
+
+	for i := range kubeconfig.Clusters {
+		kubeconfig.Clusters[i].Cluster.Extensions = withExtension(kubeconfig.Clusters[i].Cluster.Extensions, marker)
+	}
+	for i := range kubeconfig.Users {
+		kubeconfig.Users[i].User.Extensions = withExtension(kubeconfig.Users[i].User.Extensions, marker)
+	}
+	for i := range kubeconfig.Contexts {
+		kubeconfig.Contexts[i].Context.Extensions = withExtension(kubeconfig.Contexts[i].Context.Extensions, marker)
+	}
+}
+
+// withExtension returns extensions with extension added, replacing any extension of the same name
+func withExtension(extensions []types.KubeconfigExtension, extension types.KubeconfigExtension) []types.KubeconfigExtension {
+	for i := range extensions {
+		if extensions[i].Name == extension.Name {
+			extensions[i] = extension
+			return extensions
+		}
+	}
+	return append(extensions, extension)
+}
+
+// managedMarker returns the marker of an entry written by rmskubeconfig, with its RMS URL normalized
+// The marker is a ManagedMarker when generated in memory and a map when read back from a file
+func managedMarker(extensions []types.KubeconfigExtension) (types.ManagedMarker, bool) {
+	for _, extension := range extensions {
+		if extension.Name != ManagedExtensionName {
+			continue
+		}
+
+		switch marker := extension.Extension.(type) {
+		case types.ManagedMarker:
+			marker.RMSUrl = normalizeRMSUrl(marker.RMSUrl)
+			return marker, true
+		case *types.ManagedMarker:
+			if marker == nil {
+				return types.ManagedMarker{}, false
+			}
+			return types.ManagedMarker{RMSUrl: normalizeRMSUrl(marker.RMSUrl), ClusterID: marker.ClusterID}, true
+		case map[string]any:
+			rmsUrl, _ := marker["rmsUrl"].(string)
+			clusterID, _ := marker["clusterID"].(string)
+			return types.ManagedMarker{RMSUrl: normalizeRMSUrl(rmsUrl), ClusterID: clusterID}, true
+		}
+	}
+	return types.ManagedMarker{}, false
+}
+
+// normalizeRMSUrl returns rmsUrl with its scheme and host lowercased and trailing slashes trimmed,
+// so markers written for https://R.example.com/ and https://r.example.com name the same RMS
+func normalizeRMSUrl(rmsUrl string) string {
+	parsed, err := url.Parse(rmsUrl)
+	if err != nil || parsed.Host == "" {
+		return strings.TrimRight(rmsUrl, "/")
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	parsed.Path = strings.TrimRight(parsed.Path, "/")
+	parsed.RawPath = ""
+	return parsed.String()
+}
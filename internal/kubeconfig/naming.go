@@ -0,0 +1,144 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// ParseNameTemplate parses a text/template naming kubeconfig entries, executed with types.NameTemplateData
+// The template is executed against sample data so references to unknown fields fail here rather than during a run
+// A label or annotation missing from a cluster renders as an empty string (missingkey=zero), not "<no value>"
+func ParseNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("name").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := types.NameTemplateData{
+		Kind:        "context",
+		Name:        "local",
+		ClusterID:   "c-m-00000000",
+		ClusterName: "local",
+		RMSHost:     "rancher.example.com",
+		Labels:      map[string]string{},
+		Annotations: map[string]string{},
+	}
+	if _, err := renderName(tmpl, sample); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// renderName executes tmpl with data, surrounding whitespace is trimmed from the name
+func renderName(tmpl *template.Template, data types.NameTemplateData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// rmsHost returns the host of the RMS URL used as NameTemplateData.RMSHost
+func rmsHost(baseUrl string) string {
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// nameEntries renames the clusters, users and contexts of the kubeconfig generated for clusterID with
+// opts.NameTemplate, updating the references of contexts and current-context to the new names
+func nameEntries(kubeconfig *types.Kubeconfig, clusterID, host string, opts Options) error {
+	cluster := opts.Clusters[clusterID]
+	data := types.NameTemplateData{
+		ClusterID:   clusterID,
+		ClusterName: cluster.Name,
+		RMSHost:     host,
+		Labels:      cluster.Labels,
+		Annotations: cluster.Annotations,
+		Env:         cluster.Labels["env"],
+	}
+
+	clusterNames, err := renderNames(opts.NameTemplate, data, "cluster", clusterEntryNames(kubeconfig))
+	if err != nil {
+		return err
+	}
+	userNames, err := renderNames(opts.NameTemplate, data, "user", userEntryNames(kubeconfig))
+	if err != nil {
+		return err
+	}
+	contextNames, err := renderNames(opts.NameTemplate, data, "context", contextEntryNames(kubeconfig))
+	if err != nil {
+		return err
+	}
+
+	// every name is mapped at once, so names swapped by the template are not renamed twice
+	rename := func(names map[string]string, name string) string {
+		if renamed, ok := names[name]; ok {
+			return renamed
+		}
+		return name
+	}
+	for i := range kubeconfig.Clusters {
+		kubeconfig.Clusters[i].Name = rename(clusterNames, kubeconfig.Clusters[i].Name)
+	}
+	for i := range kubeconfig.Users {
+		kubeconfig.Users[i].Name = rename(userNames, kubeconfig.Users[i].Name)
+	}
+	for i := range kubeconfig.Contexts {
+		kubeconfig.Contexts[i].Name = rename(contextNames, kubeconfig.Contexts[i].Name)
+		kubeconfig.Contexts[i].Context.Cluster = rename(clusterNames, kubeconfig.Contexts[i].Context.Cluster)
+		kubeconfig.Contexts[i].Context.User = rename(userNames, kubeconfig.Contexts[i].Context.User)
+	}
+	if kubeconfig.CurrentContext != "" {
+		kubeconfig.CurrentContext = rename(contextNames, kubeconfig.CurrentContext)
+	}
+
+	return nil
+}
+
+// renderNames renders the new name of every entry of one kind, failing when a name is empty
+// or when two entries of the cluster would get the same name
+func renderNames(tmpl *template.Template, data types.NameTemplateData, kind string, names []string) (map[string]string, error) {
+	renamed := make(map[string]string, len(names))
+	renderedFrom := make(map[string]string, len(names))
+
+	for _, name := range names {
+		data.Kind, data.Name = kind, name
+
+		rendered, err := renderName(tmpl, data)
+		if err != nil {
+			return nil, &types.RequestError{
+				Code:      types.ErrNameTemplateCode,
+				Message:   fmt.Sprintf("error rendering name template for %s %q of cluster %s: %v", kind, name, data.ClusterID, err),
+				ClusterID: data.ClusterID,
+				Err:       err,
+			}
+		}
+		if rendered == "" {
+			return nil, &types.RequestError{
+				Code:      types.ErrNameTemplateCode,
+				Message:   fmt.Sprintf("name template renders an empty name for %s %q of cluster %s", kind, name, data.ClusterID),
+				ClusterID: data.ClusterID,
+			}
+		}
+		if other, ok := renderedFrom[rendered]; ok && other != name {
+			return nil, &types.RequestError{
+				Code:      types.ErrNameTemplateCode,
+				Message:   fmt.Sprintf("name template renders %ss %q and %q of cluster %s both as %q", kind, other, name, data.ClusterID, rendered),
+				ClusterID: data.ClusterID,
+			}
+		}
+
+		renderedFrom[rendered] = name
+		renamed[name] = rendered
+	}
+
+	return renamed, nil
+}
@@ -0,0 +1,164 @@
+package kubeconfig
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+func TestParseNameTemplate(t *testing.T) {
+	valid := []string{"rms-{{.Env}}-{{.ClusterName}}", "{{.ClusterID}}", "{{.Kind}}-{{index .Labels \"team\"}}", "{{.RMSHost}}-{{.Name}}"}
+	for _, text := range valid {
+		if _, err := ParseNameTemplate(text); err != nil {
+			t.Errorf("ParseNameTemplate(%q) expected no error, but got: %v", text, err)
+		}
+	}
+
+	invalid := []string{"{{.ClusterName", "{{.Project}}", "{{.ClusterName | slugify}}"}
+	for _, text := range invalid {
+		if _, err := ParseNameTemplate(text); err == nil {
+			t.Errorf("ParseNameTemplate(%q) expected error, but got nil", text)
+		}
+	}
+}
+
+func TestGenerateCombinedKubeconfig_NameTemplate(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-1": "prod", "c-2": "dev"})
+	defer mockServer.Close()
+
+	tmpl, err := ParseNameTemplate("{{.Kind}}-{{.Env}}-{{.ClusterName}}")
+	if err != nil {
+		t.Fatalf("failed to parse template: %v", err)
+	}
+	opts := Options{
+		NameTemplate: tmpl,
+		Clusters: map[string]types.RMSCluster{
+			"c-1": {ID: "c-1", Name: "Prod", Labels: map[string]string{"env": "eu"}},
+			"c-2": {ID: "c-2", Name: "Dev", Labels: map[string]string{"env": "us"}},
+		},
+	}
+
+	tempDir := t.TempDir()
+	report, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-1", "c-2"}, opts)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	kubeconfig := readKubeconfig(t, tempDir+"/config")
+	if names := clusterNames(kubeconfig); !reflect.DeepEqual(names, []string{"cluster-eu-Prod", "cluster-us-Dev"}) {
+		t.Errorf("expected templated cluster names, got %v", names)
+	}
+	expected := []types.KubeconfigContextDetails{
+		{Cluster: "cluster-eu-Prod", User: "user-eu-Prod"},
+		{Cluster: "cluster-us-Dev", User: "user-us-Dev"},
+	}
+	for i, kubeContext := range kubeconfig.Contexts {
+		if kubeContext.Context.Cluster != expected[i].Cluster || kubeContext.Context.User != expected[i].User {
+			t.Errorf("expected context %s to reference %+v, got %+v", kubeContext.Name, expected[i], kubeContext.Context)
+		}
+		if marker, ok := managedMarker(kubeContext.Context.Extensions); !ok || marker.ClusterID == "" {
+			t.Errorf("expected renamed context %s to keep its managed marker", kubeContext.Name)
+		}
+	}
+	if contexts := report.Clusters[0].Contexts; !reflect.DeepEqual(contexts, []string{"context-eu-Prod"}) {
+		t.Errorf("expected report to list the templated context, got %v", contexts)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_NameTemplateNamedCurrentContext(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-1": "prod", "c-2": "dev"})
+	defer mockServer.Close()
+
+	tmpl, err := ParseNameTemplate("rms-{{.ClusterName}}")
+	if err != nil {
+		t.Fatalf("failed to parse template: %v", err)
+	}
+	// no entry is called prod once renamed, the RMS cluster still is
+	opts := Options{
+		NameTemplate:       tmpl,
+		CurrentContext:     types.CurrentContextNamed,
+		CurrentContextName: "prod",
+		Clusters: map[string]types.RMSCluster{
+			"c-1": {ID: "c-1", Name: "prod"},
+			"c-2": {ID: "c-2", Name: "dev"},
+		},
+	}
+
+	tempDir := t.TempDir()
+	if _, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-1", "c-2"}, opts); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if got := readKubeconfig(t, tempDir+"/config").CurrentContext; got != "rms-prod" {
+		t.Errorf("expected current-context rms-prod, got %q", got)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_NameTemplateEmptyName(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-1": "prod", "c-2": "dev"})
+	defer mockServer.Close()
+
+	tmpl, err := ParseNameTemplate("{{.Env}}")
+	if err != nil {
+		t.Fatalf("failed to parse template: %v", err)
+	}
+	opts := Options{
+		NameTemplate:    tmpl,
+		ContinueOnError: true,
+		Clusters:        map[string]types.RMSCluster{"c-1": {ID: "c-1", Labels: map[string]string{"env": "prod"}}},
+	}
+
+	_, err = GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", t.TempDir(), []string{"c-1", "c-2"}, opts)
+
+	var genErr *types.GenerateError
+	if !errors.As(err, &genErr) || len(genErr.Failures) != 1 {
+		t.Fatalf("expected one failed cluster, but got: %v", err)
+	}
+	if failure := genErr.Failures[0]; failure.ClusterID != "c-2" || !errors.Is(failure, types.ErrNameTemplate) {
+		t.Errorf("expected c-2 to fail with ErrNameTemplate, got %v", failure)
+	}
+}
+
+func TestGenerateCombinedKubeconfig_NameTemplateMissingLabel(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-1": "prod", "c-2": "dev"})
+	defer mockServer.Close()
+
+	tmpl, err := ParseNameTemplate(`{{.ClusterName}}{{.Labels.team}}-{{or .Labels.team "shared"}}`)
+	if err != nil {
+		t.Fatalf("failed to parse template: %v", err)
+	}
+	opts := Options{
+		NameTemplate: tmpl,
+		Clusters: map[string]types.RMSCluster{
+			"c-1": {ID: "c-1", Name: "prod", Labels: map[string]string{"team": "payments"}},
+			"c-2": {ID: "c-2", Name: "dev", Labels: map[string]string{"env": "dev"}},
+		},
+	}
+
+	tempDir := t.TempDir()
+	if _, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, []string{"c-1", "c-2"}, opts); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	expected := []string{"dev-shared", "prodpayments-payments"}
+	if names := contextNames(readKubeconfig(t, tempDir+"/config")); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected a missing label to render empty, got %v", names)
+	}
+}
+
+func TestNameEntries_DuplicateNames(t *testing.T) {
+	kubeconfig := &types.Kubeconfig{Contexts: []types.KubeconfigContext{{Name: "ace"}, {Name: "ace-node1"}}}
+
+	tmpl, err := ParseNameTemplate("{{.ClusterID}}")
+	if err != nil {
+		t.Fatalf("failed to parse template: %v", err)
+	}
+
+	err = nameEntries(kubeconfig, "c-1", "rms.test", Options{NameTemplate: tmpl})
+	if !errors.Is(err, types.ErrNameTemplate) {
+		t.Fatalf("expected ErrNameTemplate for contexts rendered to the same name, but got: %v", err)
+	}
+}
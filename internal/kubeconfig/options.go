@@ -0,0 +1,130 @@
+package kubeconfig
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// DefaultRequestTimeout bounds a single RMS request when Options.RequestTimeout is not set
+const DefaultRequestTimeout = 30 * time.Second
+
+// DefaultLockTimeout bounds the wait for another run to release the output file lock
+const DefaultLockTimeout = 30 * time.Second
+
+// DefaultBackups is the number of backups of a replaced kubeconfig kept by default
+const DefaultBackups = 5
+
+// DefaultFileMode is the mode of a newly written kubeconfig, it holds bearer tokens so only the owner may read it
+const DefaultFileMode os.FileMode = 0600
+
+// Options holds tunables for requests made against the RMS API
+type Options struct {
+	// HTTPClient is shared by every request, a default client is used when nil
+	HTTPClient *http.Client
+	// PageLimit sets the `limit` query parameter when listing clusters, zero uses the RMS default
+	PageLimit int
+	// Concurrency bounds the number of generateKubeconfig requests in flight, values below one run sequentially
+	Concurrency int
+	// RequestTimeout bounds each individual request attempt, zero uses DefaultRequestTimeout
+	RequestTimeout time.Duration
+	// Retry controls how failed requests are retried, the zero value disables retries
+	Retry RetryPolicy
+	// ContinueOnError keeps generating after a cluster fails, writing the clusters that succeeded
+	// and returning a *types.GenerateError listing the failures
+	ContinueOnError bool
+	// AllowEmpty lets an empty cluster list overwrite an existing output file
+	AllowEmpty bool
+	// Merge loads the existing output file and replaces only the entries rmskubeconfig manages
+	Merge bool
+	// CurrentContext selects how current-context of the written kubeconfig is chosen
+	CurrentContext types.CurrentContextMode
+	// CurrentContextName is the context name, kubeconfig or RMS cluster name or cluster ID used with types.CurrentContextNamed
+	CurrentContextName string
+	// Sort orders the entries of the combined kubeconfig, the zero value sorts contexts by name
+	Sort types.SortKey
+	// NameTemplate renames the clusters, users and contexts of each generated kubeconfig, see ParseNameTemplate
+	NameTemplate *template.Template
+	// Clusters holds the RMS clusters by ID, their name and labels are available to NameTemplate
+	Clusters map[string]types.RMSCluster
+	// Collisions resolves names shared by the entries of several clusters, the zero value fails the run
+	Collisions types.CollisionStrategy
+	// DryRun builds the combined kubeconfig and reports how it differs from the output file without writing it
+	DryRun bool
+	// FileName is the name of the output file inside the output path, ConfigFileName is used when empty
+	FileName string
+	// LockTimeout bounds the wait for the output file lock held by another run, zero uses DefaultLockTimeout
+	LockTimeout time.Duration
+	// Backups is the number of timestamped backups of a replaced output file to keep, zero disables backups
+	Backups int
+	// FileMode is applied to the output file, zero uses DefaultFileMode for a new or replaced group- or
+	// world-readable file and keeps the mode of an owner-only or merged existing file
+	FileMode os.FileMode
+	// StrictPermissions fails instead of warning when a group- or world-readable output file is merged into and kept readable
+	StrictPermissions bool
+	// Logger receives warnings, slog.Default() is used when nil
+	Logger *slog.Logger
+}
+
+// RetryPolicy controls retries of failed RMS requests
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per request, values below two disable retries
+	MaxAttempts int
+	// BaseBackoff is the wait before the first retry, doubled on each further retry
+	BaseBackoff time.Duration
+	// MaxBackoff caps the wait between retries, zero means no cap
+	// A Retry-After longer than MaxBackoff ends the retries with the failed response
+	MaxBackoff time.Duration
+	// Jitter randomly shortens each wait by up to this fraction (0 to 1) of it
+	Jitter float64
+}
+
+// DefaultRetryPolicy retries transient RMS failures a few times with jittered exponential backoff
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseBackoff: 500 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+	Jitter:      0.2,
+}
+
+// withDefaults returns a copy of the options with unset values filled in
+func (o Options) withDefaults() Options {
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{}
+	}
+	if o.RequestTimeout <= 0 {
+		o.RequestTimeout = DefaultRequestTimeout
+	}
+	if o.LockTimeout <= 0 {
+		o.LockTimeout = DefaultLockTimeout
+	}
+	if o.FileName == "" {
+		o.FileName = ConfigFileName
+	}
+	if o.Logger == nil {
+		o.Logger = slog.Default()
+	}
+	return o
+}
+
+// concurrency returns the number of workers to start for the given number of jobs
+func (o Options) concurrency(jobs int) int {
+	workers := o.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > jobs {
+		workers = jobs
+	}
+	return workers
+}
+
+// outputFile returns the path of the kubeconfig file written to outputPath
+func (o Options) outputFile(outputPath string) string {
+	return filepath.Join(outputPath, o.FileName)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package kubeconfig
+
+import "os"
+
+// chownLike is a no-op where file ownership is not expressed as uid/gid
+func chownLike(f *os.File, info os.FileInfo) error {
+	return nil
+}
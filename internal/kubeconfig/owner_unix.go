@@ -0,0 +1,17 @@
+//go:build unix
+
+package kubeconfig
+
+import (
+	"os"
+	"syscall"
+)
+
+// chownLike gives f the owner and group of the file described by info
+func chownLike(f *os.File, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return f.Chown(int(stat.Uid), int(stat.Gid))
+}
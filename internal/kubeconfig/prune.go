@@ -0,0 +1,108 @@
+package kubeconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// PruneKubeconfig removes entries managed for the RMS at baseUrl whose cluster no longer exists in RMS
+// from the kubeconfig file (opts.FileName) in outputPath. With dryRun the file is left untouched
+// The returned entries are those removed, or that would be removed
+func PruneKubeconfig(ctx context.Context, baseUrl, apiToken, outputPath string, dryRun bool, opts Options) ([]types.PrunedEntry, error) {
+	opts = opts.withDefaults()
+	configPath, err := resolveConfigFile(opts.outputFile(outputPath))
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing to prune, don't bother RMS
+	if _, err := os.Stat(configPath); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	clusters, err := GetClusters(ctx, baseUrl, apiToken, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// an empty cluster list usually means a bad token or filter, don't strip every managed entry because of it
+	if len(clusters) == 0 && !opts.AllowEmpty {
+		return nil, &types.RequestError{
+			Code:    types.ErrWriteCode,
+			Message: fmt.Sprintf("refusing to prune %s against an empty cluster list", configPath),
+		}
+	}
+
+	unlock, err := lockConfigFile(ctx, configPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	existing, err := readConfigFile(configPath)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+
+	live := make(map[string]bool, len(clusters))
+	for _, cluster := range clusters {
+		live[cluster.ID] = true
+	}
+
+	pruned, removed := pruneStale(existing, normalizeRMSUrl(baseUrl), live)
+	if dryRun || len(removed) == 0 {
+		return removed, nil
+	}
+
+	// the entries not pruned are kept, so is the file mode
+	if err := writeKubeconfigFile(pruned, configPath, true, opts); err != nil {
+		return nil, err
+	}
+
+	return removed, nil
+}
+
+// pruneStale returns kubeconfig without the entries managed for rmsUrl whose cluster ID is not in live
+// rmsUrl must be normalized with normalizeRMSUrl, like the markers it is compared with
+// current-context is cleared when it names a removed context
+func pruneStale(kubeconfig *types.Kubeconfig, rmsUrl string, live map[string]bool) (*types.Kubeconfig, []types.PrunedEntry) {
+	pruned := *kubeconfig
+	var removed []types.PrunedEntry
+
+	pruned.Clusters = pruneEntries("cluster", kubeconfig.Clusters, rmsUrl, live, &removed,
+		func(c types.KubeconfigCluster) string { return c.Name },
+		func(c types.KubeconfigCluster) []types.KubeconfigExtension { return c.Cluster.Extensions })
+	pruned.Users = pruneEntries("user", kubeconfig.Users, rmsUrl, live, &removed,
+		func(u types.KubeconfigUser) string { return u.Name },
+		func(u types.KubeconfigUser) []types.KubeconfigExtension { return u.User.Extensions })
+	pruned.Contexts = pruneEntries("context", kubeconfig.Contexts, rmsUrl, live, &removed,
+		func(c types.KubeconfigContext) string { return c.Name },
+		func(c types.KubeconfigContext) []types.KubeconfigExtension { return c.Context.Extensions })
+
+	for _, entry := range removed {
+		if entry.Kind == "context" && entry.Name == pruned.CurrentContext {
+			pruned.CurrentContext = ""
+		}
+	}
+
+	return &pruned, removed
+}
+
+// pruneEntries keeps the entries that are unmanaged, managed for another RMS or generated for a live cluster
+func pruneEntries[T any](kind string, entries []T, rmsUrl string, live map[string]bool, removed *[]types.PrunedEntry, name func(T) string, extensions func(T) []types.KubeconfigExtension) []T {
+	kept := make([]T, 0, len(entries))
+	for _, entry := range entries {
+		marker, managed := managedMarker(extensions(entry))
+		if managed && marker.RMSUrl == rmsUrl && !live[marker.ClusterID] {
+			*removed = append(*removed, types.PrunedEntry{Kind: kind, Name: name(entry), ClusterID: marker.ClusterID})
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
@@ -0,0 +1,204 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// managedKubeconfig holds entries for a live cluster (c-dev), a deleted cluster (c-old),
+// a cluster from another RMS and an unmanaged cluster
+const managedKubeconfig = `apiVersion: v1
+kind: Config
+current-context: old
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.test
+    extensions:
+    - name: rmskubeconfig
+      extension: {rmsUrl: %[1]s, clusterID: c-dev}
+- name: old
+  cluster:
+    server: https://old.test
+    extensions:
+    - name: rmskubeconfig
+      extension: {rmsUrl: %[1]s, clusterID: c-old}
+- name: other-rms
+  cluster:
+    server: https://other.test
+    extensions:
+    - name: rmskubeconfig
+      extension: {rmsUrl: https://other-rms.test, clusterID: c-old}
+- name: kind-dev
+  cluster:
+    server: https://127.0.0.1:6443
+users:
+- name: dev
+  user:
+    token: dev-token
+    extensions:
+    - name: rmskubeconfig
+      extension: {rmsUrl: %[1]s, clusterID: c-dev}
+- name: old
+  user:
+    token: old-token
+    extensions:
+    - name: rmskubeconfig
+      extension: {rmsUrl: %[1]s, clusterID: c-old}
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev
+    extensions:
+    - name: rmskubeconfig
+      extension: {rmsUrl: %[1]s, clusterID: c-dev}
+- name: old
+  context:
+    cluster: old
+    user: old
+    extensions:
+    - name: rmskubeconfig
+      extension: {rmsUrl: %[1]s, clusterID: c-old}
+`
+
+// mockClusterListServer serves the given clusters from the cluster list endpoint
+func mockClusterListServer(clusters []types.RMSCluster) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.RMSClusterResponse{Data: clusters})
+	}))
+}
+
+func TestPruneKubeconfig(t *testing.T) {
+	mockServer := mockClusterListServer([]types.RMSCluster{{ID: "c-dev", Name: "dev"}})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	configPath := tempDir + "/config"
+	existing := []byte(fmt.Sprintf(managedKubeconfig, mockServer.URL))
+	if err := os.WriteFile(configPath, existing, 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	expectedRemoved := []types.PrunedEntry{
+		{Kind: "cluster", Name: "old", ClusterID: "c-old"},
+		{Kind: "user", Name: "old", ClusterID: "c-old"},
+		{Kind: "context", Name: "old", ClusterID: "c-old"},
+	}
+
+	// dry run reports without writing
+	removed, err := PruneKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, true, Options{})
+	if err != nil {
+		t.Fatalf("Function returned an error: %v", err)
+	}
+	if !reflect.DeepEqual(removed, expectedRemoved) {
+		t.Errorf("expected dry run to report %v, got %v", expectedRemoved, removed)
+	}
+	if data, _ := os.ReadFile(configPath); string(data) != string(existing) {
+		t.Errorf("expected dry run to leave the config untouched")
+	}
+
+	removed, err = PruneKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, false, Options{})
+	if err != nil {
+		t.Fatalf("Function returned an error: %v", err)
+	}
+	if !reflect.DeepEqual(removed, expectedRemoved) {
+		t.Errorf("expected prune to remove %v, got %v", expectedRemoved, removed)
+	}
+
+	pruned := readKubeconfig(t, configPath)
+	expectedClusters := []string{"dev", "other-rms", "kind-dev"}
+	if got := clusterNames(pruned); !reflect.DeepEqual(got, expectedClusters) {
+		t.Errorf("expected clusters %v, got %v", expectedClusters, got)
+	}
+	if len(pruned.Users) != 1 || len(pruned.Contexts) != 1 {
+		t.Errorf("expected one user and one context to remain, got %d and %d", len(pruned.Users), len(pruned.Contexts))
+	}
+	if pruned.CurrentContext != "" {
+		t.Errorf("expected current-context naming a pruned context to be cleared, got %q", pruned.CurrentContext)
+	}
+}
+
+func TestPruneKubeconfig_TrailingSlashRMSUrl(t *testing.T) {
+	mockServer := mockClusterListServer([]types.RMSCluster{{ID: "c-dev", Name: "dev"}})
+	defer mockServer.Close()
+
+	// entries written while the RMS URL was set with a trailing slash
+	tempDir := t.TempDir()
+	if err := os.WriteFile(tempDir+"/config", []byte(fmt.Sprintf(managedKubeconfig, mockServer.URL+"/")), 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	removed, err := PruneKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, true, Options{})
+	if err != nil {
+		t.Fatalf("Function returned an error: %v", err)
+	}
+	if len(removed) != 3 {
+		t.Errorf("expected the 3 entries of c-old to be pruned, got %v", removed)
+	}
+}
+
+func TestNormalizeRMSUrl(t *testing.T) {
+	tests := map[string]string{
+		"https://r.example.com":          "https://r.example.com",
+		"https://r.example.com/":         "https://r.example.com",
+		"HTTPS://R.Example.com/":         "https://r.example.com",
+		"https://r.example.com/rancher/": "https://r.example.com/rancher",
+		"https://r.example.com/Rancher":  "https://r.example.com/Rancher",
+	}
+
+	for rmsUrl, expected := range tests {
+		if got := normalizeRMSUrl(rmsUrl); got != expected {
+			t.Errorf("normalizeRMSUrl(%q) expected %q, got %q", rmsUrl, expected, got)
+		}
+	}
+}
+
+func TestPruneKubeconfig_EmptyClusterList(t *testing.T) {
+	mockServer := mockClusterListServer([]types.RMSCluster{})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	if err := os.WriteFile(tempDir+"/config", []byte(fmt.Sprintf(managedKubeconfig, mockServer.URL)), 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	_, err := PruneKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, false, Options{})
+	if !errors.Is(err, types.ErrWrite) {
+		t.Errorf("expected refusal to prune against an empty cluster list, got: %v", err)
+	}
+}
+
+func TestPruneKubeconfig_MissingFile(t *testing.T) {
+	removed, err := PruneKubeconfig(context.Background(), "https://rms.test", "mock-token", t.TempDir(), false, Options{})
+	if err != nil || removed != nil {
+		t.Errorf("expected nothing to prune without a config file, got %v, %v", removed, err)
+	}
+}
+
+func TestPruneKubeconfig_ListError(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	if err := os.WriteFile(tempDir+"/config", []byte(fmt.Sprintf(managedKubeconfig, mockServer.URL)), 0600); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	_, err := PruneKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, false, Options{})
+	if !errors.Is(err, types.ErrUnauthorized) {
+		t.Errorf("expected unauthorized error, got: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// response holds a fully read RMS response along with the number of attempts it took
+type response struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+	Attempts   int
+}
+
+// maxErrorSnippet bounds how much of a non-JSON error body is kept
+const maxErrorSnippet = 256
+
+// doRequest sends req to RMS, retrying failures allowed by opts.Retry
+// Each attempt is bounded by opts.RequestTimeout, any HTTP status is returned for the caller to inspect
+// The returned response is never nil so callers can always report the attempt count
+func doRequest(ctx context.Context, opts Options, req *http.Request) (*response, error) {
+	resp := &response{}
+
+	for {
+		resp.Attempts++
+
+		err := doAttempt(ctx, opts, req, resp)
+		if !shouldRetry(ctx, req.Method, resp, err) || resp.Attempts >= opts.Retry.MaxAttempts {
+			return resp, err
+		}
+
+		wait := opts.Retry.backoff(resp.Attempts)
+		if retryAfter, ok := parseRetryAfter(resp.Header, time.Now()); ok && err == nil {
+			// RMS asks for a longer wait than the policy allows, give up rather than retry early or hang
+			if opts.Retry.MaxBackoff > 0 && retryAfter > opts.Retry.MaxBackoff {
+				return resp, err
+			}
+			wait = retryAfter
+		}
+
+		// give up now rather than sleep past the overall deadline
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+	}
+}
+
+// doAttempt performs a single attempt of req and reads the whole body into resp
+func doAttempt(ctx context.Context, opts Options, req *http.Request, resp *response) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.RequestTimeout)
+	defer cancel()
+
+	resp.StatusCode, resp.Status, resp.Header, resp.Body = 0, "", nil, nil
+
+	httpResp, err := opts.HTTPClient.Do(req.Clone(ctx))
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+
+	resp.StatusCode, resp.Status, resp.Header, resp.Body = httpResp.StatusCode, httpResp.Status, httpResp.Header, body
+	return nil
+}
+
+// shouldRetry reports whether a failed attempt is safe to repeat
+// Idempotent requests retry on transport errors and transient statuses, other requests only
+// retry when RMS cannot have acted on them (no connection was made, 429 or 503)
+func shouldRetry(ctx context.Context, method string, resp *response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	idempotent := method == http.MethodGet || method == http.MethodHead
+
+	if err != nil {
+		if idempotent {
+			return true
+		}
+		// a failed dial (refused, unreachable, DNS) never reached RMS, checked without platform errnos
+		var opErr *net.OpError
+		var dnsErr *net.DNSError
+		return (errors.As(err, &opErr) && opErr.Op == "dial") || errors.As(err, &dnsErr)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// backoff returns the wait before the next attempt, doubling from BaseBackoff up to MaxBackoff
+// Without MaxBackoff the doubling stops before the wait would overflow
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	wait := r.BaseBackoff
+	for i := 1; i < attempt && (r.MaxBackoff <= 0 || wait < r.MaxBackoff) && wait <= math.MaxInt64/2; i++ {
+		wait *= 2
+	}
+	if r.MaxBackoff > 0 && wait > r.MaxBackoff {
+		wait = r.MaxBackoff
+	}
+	if r.Jitter > 0 {
+		wait -= time.Duration(r.Jitter * rand.Float64() * float64(wait))
+	}
+	return wait
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		wait := date.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
+
+// apiErrorDetail extracts the code and message of a Rancher API error body
+// Bodies that are not Rancher errors fall back to a truncated text snippet
+func apiErrorDetail(body []byte) (code, message string) {
+	var apiErr types.RMSAPIError
+	if err := json.Unmarshal(body, &apiErr); err == nil && (apiErr.Code != "" || apiErr.Message != "") {
+		return apiErr.Code, apiErr.Message
+	}
+
+	snippet := strings.TrimSpace(string(body))
+	if len(snippet) > maxErrorSnippet {
+		snippet = strings.ToValidUTF8(snippet[:maxErrorSnippet], "") + "..."
+	}
+	return "", snippet
+}
+
+// statusError builds the RequestError for an unexpected response status, including any detail RMS returned
+func statusError(resp *response, message string) *types.RequestError {
+	rmsCode, rmsMessage := apiErrorDetail(resp.Body)
+
+	detail := resp.Status
+	switch {
+	case rmsCode != "" && rmsMessage != "":
+		detail = fmt.Sprintf("%s (%s: %s)", resp.Status, rmsCode, rmsMessage)
+	case rmsMessage != "":
+		detail = fmt.Sprintf("%s (%s)", resp.Status, rmsMessage)
+	case rmsCode != "":
+		detail = fmt.Sprintf("%s (%s)", resp.Status, rmsCode)
+	}
+
+	return &types.RequestError{
+		Code:       types.StatusErrorCode(resp.StatusCode),
+		Message:    fmt.Sprintf("%s: %s", message, detail),
+		Attempts:   resp.Attempts,
+		StatusCode: resp.StatusCode,
+		RMSCode:    rmsCode,
+		RMSMessage: rmsMessage,
+	}
+}
@@ -0,0 +1,369 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// testRetryPolicy retries quickly so tests do not sleep
+var testRetryPolicy = RetryPolicy{MaxAttempts: 4, BaseBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func TestGetClusters_RetrySucceedsAfterFailures(t *testing.T) {
+	var requests int32
+	failures := int32(2)
+
+	// mock rms-api server failing the first N requests
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.RMSClusterResponse{Data: []types.RMSCluster{{ID: "1", Name: "Cluster-1"}}})
+	}))
+	defer mockServer.Close()
+
+	clusters, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{Retry: testRetryPolicy})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if len(clusters) != 1 {
+		t.Errorf("expected 1 cluster, but got %d", len(clusters))
+	}
+	if got := atomic.LoadInt32(&requests); got != failures+1 {
+		t.Errorf("expected %d requests, but got %d", failures+1, got)
+	}
+}
+
+func TestGetClusters_RetryExhausted(t *testing.T) {
+	var requests int32
+
+	// mock rms-api server that is always busy
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer mockServer.Close()
+
+	_, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{Retry: testRetryPolicy})
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+
+	var reqErr *types.RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("expected custom RequestError, but got: %T", err)
+	}
+
+	if reqErr.Attempts != testRetryPolicy.MaxAttempts {
+		t.Errorf("expected %d attempts recorded, but got %d", testRetryPolicy.MaxAttempts, reqErr.Attempts)
+	}
+	if got := atomic.LoadInt32(&requests); int(got) != testRetryPolicy.MaxAttempts {
+		t.Errorf("expected %d requests, but got %d", testRetryPolicy.MaxAttempts, got)
+	}
+	if !strings.Contains(err.Error(), "attempts: 4") {
+		t.Errorf("expected attempts in error message, but got: %v", err)
+	}
+}
+
+func TestGetClusters_NoRetryOnClientError(t *testing.T) {
+	var requests int32
+
+	// mock rms-api server rejecting the token
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer mockServer.Close()
+
+	_, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{Retry: testRetryPolicy})
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("expected 1 request, but got %d", got)
+	}
+}
+
+func TestGenerateKubeconfig_RetryAfter(t *testing.T) {
+	var requests int32
+	var firstAt, secondAt time.Time
+
+	// mock rms-api server rate limiting the first request
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			firstAt = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		secondAt = time.Now()
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: "clusters: []"})
+	}))
+	defer mockServer.Close()
+
+	policy := testRetryPolicy
+	policy.MaxBackoff = 2 * time.Second
+	opts := Options{Retry: policy}.withDefaults()
+	_, err := generateKubeconfig(context.Background(), opts, mockServer.URL, "mock-token", "cluster1")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if wait := secondAt.Sub(firstAt); wait < 900*time.Millisecond {
+		t.Errorf("expected Retry-After to be honored, retried after %v", wait)
+	}
+}
+
+func TestGenerateKubeconfig_NoRetryOnBadGateway(t *testing.T) {
+	var requests int32
+
+	// mock rms-api server failing after it may have acted on the request
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer mockServer.Close()
+
+	opts := Options{Retry: testRetryPolicy}.withDefaults()
+	_, err := generateKubeconfig(context.Background(), opts, mockServer.URL, "mock-token", "cluster1")
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("expected generateKubeconfig POST not to be retried on 502, got %d requests", got)
+	}
+}
+
+func TestDoRequest_DeadlineBeforeRetryAfter(t *testing.T) {
+	var requests int32
+
+	// mock rms-api server asking for a retry far in the future
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mockServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequest(http.MethodGet, mockServer.URL, nil)
+	resp, err := doRequest(ctx, Options{Retry: testRetryPolicy}.withDefaults(), req)
+	if err != nil {
+		t.Fatalf("expected no transport error, but got: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Attempts != 1 {
+		t.Errorf("expected a single 503 attempt, got status %d after %d attempts", resp.StatusCode, resp.Attempts)
+	}
+}
+
+func TestDoRequest_RetryAfterBeyondMaxBackoff(t *testing.T) {
+	var requests int32
+
+	// mock rms-api server rate limiting for a day, with no overall deadline set
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer mockServer.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, mockServer.URL, nil)
+	start := time.Now()
+	resp, err := doRequest(context.Background(), Options{Retry: testRetryPolicy}.withDefaults(), req)
+	if err != nil {
+		t.Fatalf("expected no transport error, but got: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Attempts != 1 {
+		t.Errorf("expected a single 429 attempt, got status %d after %d attempts", resp.StatusCode, resp.Attempts)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected to give up without waiting for Retry-After, took %v", elapsed)
+	}
+}
+
+func TestDoRequest_RetryPostOnRefusedConnection(t *testing.T) {
+	// a closed server refuses connections
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	mockServer.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, mockServer.URL, nil)
+	resp, err := doRequest(context.Background(), Options{Retry: testRetryPolicy}.withDefaults(), req)
+	if err == nil {
+		t.Fatalf("expected a connection error, but got nil")
+	}
+
+	if resp.Attempts != testRetryPolicy.MaxAttempts {
+		t.Errorf("expected a POST that never connected to be retried %d times, got %d attempts", testRetryPolicy.MaxAttempts, resp.Attempts)
+	}
+}
+
+func TestShouldRetry_TransportErrors(t *testing.T) {
+	resp := &response{}
+	tests := []struct {
+		method   string
+		err      error
+		expected bool
+	}{
+		{http.MethodPost, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{http.MethodPost, &net.DNSError{Err: "no such host", Name: "rms.test"}, true},
+		{http.MethodPost, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, false},
+		{http.MethodGet, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, true},
+	}
+
+	for _, test := range tests {
+		if got := shouldRetry(context.Background(), test.method, resp, test.err); got != test.expected {
+			t.Errorf("shouldRetry(%s, %v) expected %v, got %v", test.method, test.err, test.expected, got)
+		}
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: 500 * time.Millisecond}
+
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 500 * time.Millisecond, 500 * time.Millisecond}
+	for i, want := range expected {
+		if got := policy.backoff(i + 1); got != want {
+			t.Errorf("backoff(%d) expected %v, got %v", i+1, want, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(1); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("expected jittered backoff between 50ms and 100ms, got %v", got)
+		}
+	}
+}
+
+func TestRetryPolicy_BackoffWithoutCap(t *testing.T) {
+	policy := RetryPolicy{BaseBackoff: time.Second}
+
+	previous := time.Duration(0)
+	for attempt := 1; attempt <= 100; attempt++ {
+		got := policy.backoff(attempt)
+		if got < previous {
+			t.Fatalf("backoff(%d) expected at least %v, got %v", attempt, previous, got)
+		}
+		previous = got
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"Fri, 16 Oct 2026 10:00:30 GMT", 30 * time.Second, true},
+		{"Fri, 16 Oct 2026 09:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+
+	for _, test := range tests {
+		header := http.Header{}
+		if test.value != "" {
+			header.Set("Retry-After", test.value)
+		}
+
+		wait, ok := parseRetryAfter(header, now)
+		if ok != test.ok || wait != test.expected {
+			t.Errorf("parseRetryAfter(%q) expected (%v, %v), got (%v, %v)", test.value, test.expected, test.ok, wait, ok)
+		}
+	}
+}
+
+func TestGetClusters_RancherErrorBody(t *testing.T) {
+	// mock rms-api server returning a Rancher API error
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"type":"error","status":"401","code":"Unauthorized","message":"token expired"}`))
+	}))
+	defer mockServer.Close()
+
+	_, err := GetClusters(context.Background(), mockServer.URL, "mockApiToken", Options{})
+
+	var reqErr *types.RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("expected custom RequestError, but got: %T", err)
+	}
+
+	if reqErr.RMSCode != "Unauthorized" || reqErr.RMSMessage != "token expired" {
+		t.Errorf("expected RMS code and message to be decoded, got %q / %q", reqErr.RMSCode, reqErr.RMSMessage)
+	}
+	if !strings.Contains(err.Error(), "token expired") || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected error to include status and RMS message, but got: %v", err)
+	}
+}
+
+func TestGenerateKubeconfig_NonJSONErrorBody(t *testing.T) {
+	longBody := strings.Repeat("x", 2*maxErrorSnippet)
+
+	// mock rms-api server returning a non-JSON error page
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(longBody))
+	}))
+	defer mockServer.Close()
+
+	opts := Options{}.withDefaults()
+	_, err := generateKubeconfig(context.Background(), opts, mockServer.URL, "mock-token", "cluster1")
+
+	var reqErr *types.RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("expected custom RequestError, but got: %T", err)
+	}
+
+	if reqErr.RMSCode != "" {
+		t.Errorf("expected no RMS code for a non-JSON body, got %q", reqErr.RMSCode)
+	}
+	if expected := longBody[:maxErrorSnippet] + "..."; reqErr.RMSMessage != expected {
+		t.Errorf("expected truncated snippet of %d bytes, got %d bytes", len(expected), len(reqErr.RMSMessage))
+	}
+	if reqErr.ClusterID != "cluster1" || reqErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected cluster1 with status 502, got %q with %d", reqErr.ClusterID, reqErr.StatusCode)
+	}
+}
+
+func TestApiErrorDetail(t *testing.T) {
+	tests := []struct {
+		body    string
+		code    string
+		message string
+	}{
+		{`{"type":"error","status":"403","code":"Forbidden","message":"clusters.management.cattle.io is forbidden"}`, "Forbidden", "clusters.management.cattle.io is forbidden"},
+		{`{"type":"collection","data":[]}`, "", `{"type":"collection","data":[]}`},
+		{"  upstream connect error  \n", "", "upstream connect error"},
+		{"", "", ""},
+	}
+
+	for _, test := range tests {
+		code, message := apiErrorDetail([]byte(test.body))
+		if code != test.code || message != test.message {
+			t.Errorf("apiErrorDetail(%q) expected (%q, %q), got (%q, %q)", test.body, test.code, test.message, code, message)
+		}
+	}
+}
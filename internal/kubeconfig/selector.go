@@ -0,0 +1,224 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selector operators, following Kubernetes label selectors
+const (
+	selectorEquals    = "="
+	selectorNotEquals = "!="
+	selectorIn        = "in"
+	selectorNotIn     = "notin"
+	selectorExists    = "exists"
+	selectorNotExists = "!"
+)
+
+// requirement is a single comma-separated term of a selector
+type requirement struct {
+	key      string
+	operator string
+	values   []string
+}
+
+// selector matches a set of labels (or annotations) when every requirement holds
+type selector []requirement
+
+// parseSelector parses a Kubernetes-style selector such as `env in (prod,stage),team=payments,!deprecated`
+// Supported terms are key=value, key==value, key!=value, key in (a,b), key notin (a,b), key and !key
+func parseSelector(text string) (selector, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	l := &selectorLexer{text: text}
+	var s selector
+	for {
+		r, err := l.requirement()
+		if err != nil {
+			return nil, fmt.Errorf("selector %q: %v", text, err)
+		}
+		s = append(s, r)
+
+		l.skipSpace()
+		if l.done() {
+			return s, nil
+		}
+		if !l.consume(",") {
+			return nil, fmt.Errorf("selector %q: expected ',' at position %d", text, l.pos)
+		}
+	}
+}
+
+// matches reports whether labels satisfy every requirement, a nil selector matches everything
+func (s selector) matches(labels map[string]string) bool {
+	for _, r := range s {
+		value, ok := labels[r.key]
+		switch r.operator {
+		case selectorEquals:
+			if !ok || value != r.values[0] {
+				return false
+			}
+		case selectorNotEquals:
+			if ok && value == r.values[0] {
+				return false
+			}
+		case selectorIn:
+			if !ok || !contains(r.values, value) {
+				return false
+			}
+		case selectorNotIn:
+			if ok && contains(r.values, value) {
+				return false
+			}
+		case selectorExists:
+			if !ok {
+				return false
+			}
+		case selectorNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// selectorLexer reads the terms of a selector
+type selectorLexer struct {
+	text string
+	pos  int
+}
+
+// requirement reads one term
+func (l *selectorLexer) requirement() (requirement, error) {
+	l.skipSpace()
+
+	if l.consume("!") {
+		key, err := l.word("key")
+		if err != nil {
+			return requirement{}, err
+		}
+		return requirement{key: key, operator: selectorNotExists}, nil
+	}
+
+	key, err := l.word("key")
+	if err != nil {
+		return requirement{}, err
+	}
+
+	l.skipSpace()
+	switch {
+	case l.done() || l.peek(","):
+		return requirement{key: key, operator: selectorExists}, nil
+	case l.consume("!="):
+		value, err := l.value()
+		return requirement{key: key, operator: selectorNotEquals, values: []string{value}}, err
+	case l.consume("=="), l.consume("="):
+		value, err := l.value()
+		return requirement{key: key, operator: selectorEquals, values: []string{value}}, err
+	}
+
+	operator, err := l.word("operator")
+	if err != nil {
+		return requirement{}, err
+	}
+	if operator != selectorIn && operator != selectorNotIn {
+		return requirement{}, fmt.Errorf("unknown operator %q for key %q", operator, key)
+	}
+
+	values, err := l.set()
+	return requirement{key: key, operator: operator, values: values}, err
+}
+
+// set reads a parenthesized, comma-separated list of at least one value
+func (l *selectorLexer) set() ([]string, error) {
+	l.skipSpace()
+	if !l.consume("(") {
+		return nil, fmt.Errorf("expected '(' at position %d", l.pos)
+	}
+
+	var values []string
+	for {
+		value, err := l.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		l.skipSpace()
+		if l.consume(")") {
+			break
+		}
+		if !l.consume(",") {
+			return nil, fmt.Errorf("expected ',' or ')' at position %d", l.pos)
+		}
+	}
+
+	if len(values) == 1 && values[0] == "" {
+		return nil, fmt.Errorf("empty value set at position %d", l.pos)
+	}
+	return values, nil
+}
+
+// value reads a possibly empty value
+func (l *selectorLexer) value() (string, error) {
+	l.skipSpace()
+	start := l.pos
+	for !l.done() && !isSelectorDelimiter(l.text[l.pos]) {
+		l.pos++
+	}
+	if value := l.text[start:l.pos]; strings.ContainsAny(value, "=!") {
+		return "", fmt.Errorf("invalid value %q at position %d", value, start)
+	}
+	return l.text[start:l.pos], nil
+}
+
+// word reads a non-empty key or operator
+func (l *selectorLexer) word(what string) (string, error) {
+	l.skipSpace()
+	start := l.pos
+	for !l.done() && !isSelectorDelimiter(l.text[l.pos]) && l.text[l.pos] != '=' && l.text[l.pos] != '!' {
+		l.pos++
+	}
+	if start == l.pos {
+		return "", fmt.Errorf("expected %s at position %d", what, start)
+	}
+	return l.text[start:l.pos], nil
+}
+
+func (l *selectorLexer) skipSpace() {
+	for !l.done() && (l.text[l.pos] == ' ' || l.text[l.pos] == '\t') {
+		l.pos++
+	}
+}
+
+func (l *selectorLexer) done() bool {
+	return l.pos >= len(l.text)
+}
+
+func (l *selectorLexer) peek(token string) bool {
+	return strings.HasPrefix(l.text[l.pos:], token)
+}
+
+func (l *selectorLexer) consume(token string) bool {
+	if !l.peek(token) {
+		return false
+	}
+	l.pos += len(token)
+	return true
+}
+
+func isSelectorDelimiter(c byte) bool {
+	return c == ' ' || c == '\t' || c == ',' || c == '(' || c == ')'
+}
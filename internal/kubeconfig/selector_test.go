@@ -0,0 +1,64 @@
+package kubeconfig
+
+import "testing"
+
+func TestParseSelector_Matches(t *testing.T) {
+	prodPayments := map[string]string{"env": "prod", "team": "payments"}
+	stageSearch := map[string]string{"env": "stage", "team": "search", "deprecated": "true"}
+	unlabeled := map[string]string{}
+
+	tests := []struct {
+		selector string
+		matches  []map[string]string
+		rejects  []map[string]string
+	}{
+		{"", []map[string]string{prodPayments, unlabeled}, nil},
+		{"env=prod", []map[string]string{prodPayments}, []map[string]string{stageSearch, unlabeled}},
+		{"env==prod", []map[string]string{prodPayments}, []map[string]string{stageSearch}},
+		{"env!=prod", []map[string]string{stageSearch, unlabeled}, []map[string]string{prodPayments}},
+		{"env in (prod,stage)", []map[string]string{prodPayments, stageSearch}, []map[string]string{unlabeled}},
+		{"env notin (prod)", []map[string]string{stageSearch, unlabeled}, []map[string]string{prodPayments}},
+		{"deprecated", []map[string]string{stageSearch}, []map[string]string{prodPayments}},
+		{"!deprecated", []map[string]string{prodPayments, unlabeled}, []map[string]string{stageSearch}},
+		{"env in (prod, stage), team=payments, !deprecated", []map[string]string{prodPayments}, []map[string]string{stageSearch, unlabeled}},
+		{"app.kubernetes.io/team=payments", nil, []map[string]string{prodPayments}},
+	}
+
+	for _, test := range tests {
+		s, err := parseSelector(test.selector)
+		if err != nil {
+			t.Fatalf("parseSelector(%q) expected no error, but got: %v", test.selector, err)
+		}
+		for _, labels := range test.matches {
+			if !s.matches(labels) {
+				t.Errorf("expected %q to match %v", test.selector, labels)
+			}
+		}
+		for _, labels := range test.rejects {
+			if s.matches(labels) {
+				t.Errorf("expected %q not to match %v", test.selector, labels)
+			}
+		}
+	}
+}
+
+func TestParseSelector_Invalid(t *testing.T) {
+	invalid := []string{
+		"env in prod",
+		"env in (prod",
+		"env in ()",
+		"env=prod,",
+		",env=prod",
+		"=prod",
+		"env=prod=stage",
+		"env prod",
+		"!env=prod",
+		"env in (prod)x",
+	}
+
+	for _, text := range invalid {
+		if _, err := parseSelector(text); err == nil {
+			t.Errorf("parseSelector(%q) expected error, but got nil", text)
+		}
+	}
+}
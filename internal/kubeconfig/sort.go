@@ -0,0 +1,135 @@
+package kubeconfig
+
+import (
+	"sort"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// mergeOrder returns the order in which the kubeconfigs of clusterIDs are merged
+// Unless opts.Sort is types.SortNone they are merged by cluster ID, so the top-level settings taken from the
+// first kubeconfig setting them don't depend on the order RMS lists clusters in
+func mergeOrder(clusterIDs []string, opts Options) []int {
+	order := make([]int, len(clusterIDs))
+	for i := range order {
+		order[i] = i
+	}
+	if opts.Sort != types.SortNone {
+		sort.SliceStable(order, func(a, b int) bool { return clusterIDs[order[a]] < clusterIDs[order[b]] })
+	}
+	return order
+}
+
+// sortKubeconfig orders the contexts of kubeconfig by key, clusters and users follow the first context
+// referencing them and unreferenced ones come last by name
+// Ties are broken by the RMS cluster ID of the entries so the order never depends on the RMS listing order
+func sortKubeconfig(kubeconfig *types.Kubeconfig, key types.SortKey) {
+	if key == types.SortNone {
+		return
+	}
+
+	sort.SliceStable(kubeconfig.Contexts, func(a, b int) bool {
+		return contextLess(kubeconfig.Contexts[a], kubeconfig.Contexts[b], key)
+	})
+
+	clusterRank := make(map[string]int, len(kubeconfig.Contexts))
+	userRank := make(map[string]int, len(kubeconfig.Contexts))
+	for i, kubeContext := range kubeconfig.Contexts {
+		if _, ok := clusterRank[kubeContext.Context.Cluster]; !ok {
+			clusterRank[kubeContext.Context.Cluster] = i
+		}
+		if _, ok := userRank[kubeContext.Context.User]; !ok {
+			userRank[kubeContext.Context.User] = i
+		}
+	}
+
+	sortEntries(kubeconfig.Clusters, clusterRank,
+		func(c types.KubeconfigCluster) string { return c.Name },
+		func(c types.KubeconfigCluster) []types.KubeconfigExtension { return c.Cluster.Extensions })
+	sortEntries(kubeconfig.Users, userRank,
+		func(u types.KubeconfigUser) string { return u.Name },
+		func(u types.KubeconfigUser) []types.KubeconfigExtension { return u.User.Extensions })
+}
+
+// sortManagedEntries sorts the entries rmskubeconfig manages in a merged kubeconfig by key, within the positions
+// they hold, so the output doesn't depend on the order clusters were added in over earlier runs
+// Unmanaged entries keep their position
+func sortManagedEntries(kubeconfig *types.Kubeconfig, key types.SortKey) {
+	if key == types.SortNone {
+		return
+	}
+
+	clusterSlots, clusters := managedEntries(kubeconfig.Clusters,
+		func(c types.KubeconfigCluster) []types.KubeconfigExtension { return c.Cluster.Extensions })
+	userSlots, users := managedEntries(kubeconfig.Users,
+		func(u types.KubeconfigUser) []types.KubeconfigExtension { return u.User.Extensions })
+	contextSlots, contexts := managedEntries(kubeconfig.Contexts,
+		func(c types.KubeconfigContext) []types.KubeconfigExtension { return c.Context.Extensions })
+
+	managed := &types.Kubeconfig{Clusters: clusters, Users: users, Contexts: contexts}
+	sortKubeconfig(managed, key)
+
+	for i, slot := range clusterSlots {
+		kubeconfig.Clusters[slot] = managed.Clusters[i]
+	}
+	for i, slot := range userSlots {
+		kubeconfig.Users[slot] = managed.Users[i]
+	}
+	for i, slot := range contextSlots {
+		kubeconfig.Contexts[slot] = managed.Contexts[i]
+	}
+}
+
+// managedEntries returns the positions and copies of the entries carrying the managed marker
+func managedEntries[T any](entries []T, extensions func(T) []types.KubeconfigExtension) ([]int, []T) {
+	var slots []int
+	var managed []T
+	for i, entry := range entries {
+		if _, ok := managedMarker(extensions(entry)); ok {
+			slots = append(slots, i)
+			managed = append(managed, entry)
+		}
+	}
+	return slots, managed
+}
+
+// contextLess orders contexts by key, then by name, then by RMS cluster ID
+func contextLess(a, b types.KubeconfigContext, key types.SortKey) bool {
+	switch key {
+	case types.SortByCluster:
+		if a.Context.Cluster != b.Context.Cluster {
+			return a.Context.Cluster < b.Context.Cluster
+		}
+	case types.SortByClusterID:
+		if idA, idB := markerClusterID(a.Context.Extensions), markerClusterID(b.Context.Extensions); idA != idB {
+			return idA < idB
+		}
+	}
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return markerClusterID(a.Context.Extensions) < markerClusterID(b.Context.Extensions)
+}
+
+// sortEntries orders entries by the rank of their name, entries without a rank come last by name
+func sortEntries[T any](entries []T, rank map[string]int, name func(T) string, extensions func(T) []types.KubeconfigExtension) {
+	sort.SliceStable(entries, func(a, b int) bool {
+		rankA, rankedA := rank[name(entries[a])]
+		rankB, rankedB := rank[name(entries[b])]
+		switch {
+		case rankedA != rankedB:
+			return rankedA
+		case rankedA && rankA != rankB:
+			return rankA < rankB
+		case name(entries[a]) != name(entries[b]):
+			return name(entries[a]) < name(entries[b])
+		}
+		return markerClusterID(extensions(entries[a])) < markerClusterID(extensions(entries[b]))
+	})
+}
+
+// markerClusterID returns the RMS cluster ID an entry was generated for, empty for unmanaged entries
+func markerClusterID(extensions []types.KubeconfigExtension) string {
+	marker, _ := managedMarker(extensions)
+	return marker.ClusterID
+}
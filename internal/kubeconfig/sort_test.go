@@ -0,0 +1,151 @@
+package kubeconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestGenerateCombinedKubeconfig_StableOutput(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-prod": "prod", "c-dev": "dev", "c-qa": "qa"})
+	defer mockServer.Close()
+
+	var outputs [][]byte
+	for _, clusterIDs := range [][]string{{"c-prod", "c-dev", "c-qa"}, {"c-qa", "c-prod", "c-dev"}} {
+		tempDir := t.TempDir()
+		if _, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, clusterIDs, Options{Concurrency: 3}); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		data, err := os.ReadFile(tempDir + "/config")
+		if err != nil {
+			t.Fatalf("failed to read output file: %v", err)
+		}
+		outputs = append(outputs, data)
+	}
+
+	if string(outputs[0]) != string(outputs[1]) {
+		t.Errorf("expected byte-identical output regardless of RMS order, got:\n%s\nand:\n%s", outputs[0], outputs[1])
+	}
+}
+
+func TestSortKubeconfig(t *testing.T) {
+	tests := []struct {
+		key      types.SortKey
+		contexts []string
+		clusters []string
+	}{
+		{types.SortByContext, []string{"dev", "prod", "qa"}, []string{"zeta", "alpha", "mid", "orphan"}},
+		{types.SortByCluster, []string{"prod", "qa", "dev"}, []string{"alpha", "mid", "zeta", "orphan"}},
+		{types.SortByClusterID, []string{"prod", "qa", "dev"}, []string{"alpha", "mid", "zeta", "orphan"}},
+		{types.SortNone, []string{"dev", "qa", "prod"}, []string{"zeta", "mid", "orphan", "alpha"}},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.key), func(t *testing.T) {
+			kubeconfig := &types.Kubeconfig{}
+			for _, entry := range []struct{ id, context, cluster string }{
+				{"c-3", "dev", "zeta"},
+				{"c-2", "qa", "mid"},
+				{"c-9", "", "orphan"},
+				{"c-1", "prod", "alpha"},
+			} {
+				generated := &types.Kubeconfig{Clusters: []types.KubeconfigCluster{{Name: entry.cluster}}}
+				if entry.context != "" {
+					generated.Users = []types.KubeconfigUser{{Name: entry.context}}
+					generated.Contexts = []types.KubeconfigContext{{Name: entry.context, Context: types.KubeconfigContextDetails{Cluster: entry.cluster, User: entry.context}}}
+				}
+				markManaged(generated, "https://rms.test", entry.id)
+				mergeKubeconfig(kubeconfig, generated)
+			}
+
+			sortKubeconfig(kubeconfig, test.key)
+
+			var contexts, users []string
+			for _, kubeContext := range kubeconfig.Contexts {
+				contexts = append(contexts, kubeContext.Name)
+			}
+			for _, user := range kubeconfig.Users {
+				users = append(users, user.Name)
+			}
+			if !reflect.DeepEqual(contexts, test.contexts) {
+				t.Errorf("expected contexts %v, got %v", test.contexts, contexts)
+			}
+			if !reflect.DeepEqual(users, test.contexts) {
+				t.Errorf("expected users to follow contexts %v, got %v", test.contexts, users)
+			}
+			if names := clusterNames(*kubeconfig); !reflect.DeepEqual(names, test.clusters) {
+				t.Errorf("expected clusters %v, got %v", test.clusters, names)
+			}
+		})
+	}
+}
+
+func TestBuildCombinedKubeconfig_CurrentContextFirstFollowsSort(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-1": "prod", "c-2": "dev"})
+	defer mockServer.Close()
+
+	tests := []struct {
+		key      types.SortKey
+		expected string
+	}{
+		{types.SortByContext, "dev"},
+		{types.SortByClusterID, "prod"},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.key), func(t *testing.T) {
+			opts := Options{CurrentContext: types.CurrentContextFirst, Sort: test.key}
+			combined, _, err := BuildCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", []string{"c-2", "c-1"}, opts)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			if combined.Contexts[0].Name != test.expected || combined.CurrentContext != test.expected {
+				t.Errorf("expected first context and current-context %q, got %q and %q", test.expected, combined.Contexts[0].Name, combined.CurrentContext)
+			}
+		})
+	}
+}
+
+func TestGenerateCombinedKubeconfig_MergeStableOutput(t *testing.T) {
+	mockServer := mockRMSServer(t, map[string]string{"c-a": "a", "c-b": "b", "c-c": "c"})
+	defer mockServer.Close()
+
+	var outputs [][]byte
+	for _, runs := range [][][]string{{{"c-a", "c-c"}, {"c-a", "c-b", "c-c"}}, {{"c-a", "c-b", "c-c"}}} {
+		tempDir := t.TempDir()
+		if err := os.WriteFile(tempDir+"/config", []byte(fmt.Sprintf(existingKubeconfig, mockServer.URL)), 0600); err != nil {
+			t.Fatalf("failed to write existing config: %v", err)
+		}
+		for _, clusterIDs := range runs {
+			if _, err := GenerateCombinedKubeconfig(context.Background(), mockServer.URL, "mock-token", tempDir, clusterIDs, Options{Merge: true}); err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+		}
+
+		data, err := os.ReadFile(tempDir + "/config")
+		if err != nil {
+			t.Fatalf("failed to read output file: %v", err)
+		}
+		outputs = append(outputs, data)
+	}
+
+	if string(outputs[0]) != string(outputs[1]) {
+		t.Errorf("expected byte-identical output whichever run added b, got:\n%s\nand:\n%s", outputs[0], outputs[1])
+	}
+
+	expected := []string{"kind-dev", "a", "eks-payments", "b", "c", "prod"}
+	var kubeconfig types.Kubeconfig
+	if err := yaml.Unmarshal(outputs[0], &kubeconfig); err != nil {
+		t.Fatalf("failed to unmarshal output: %v", err)
+	}
+	if names := clusterNames(kubeconfig); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected managed clusters sorted around unmanaged ones %v, got %v", expected, names)
+	}
+}
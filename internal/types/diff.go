@@ -0,0 +1,89 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffAction describes how a kubeconfig entry differs from the existing file
+type DiffAction string
+
+const (
+	DiffAdded   DiffAction = "added"
+	DiffRemoved DiffAction = "removed"
+	DiffChanged DiffAction = "changed"
+)
+
+// FieldChange is a differing field of a kubeconfig entry
+// Secret values (tokens, keys, passwords) are redacted, certificate data is shown as a SHA-256 fingerprint
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// EntryDiff describes a cluster, user or context that differs from the existing file
+type EntryDiff struct {
+	Kind    string // cluster, user or context
+	Name    string
+	Action  DiffAction
+	Changes []FieldChange
+	// OtherChanges is set when a changed entry differs only in settings without a dedicated field (extensions, exec env, ...)
+	OtherChanges bool
+}
+
+// KubeconfigDiff describes the changes writing a kubeconfig would make to the existing file
+type KubeconfigDiff struct {
+	OutputFile     string
+	Entries        []EntryDiff
+	CurrentContext *FieldChange // set when current-context would change
+}
+
+// HasChanges reports whether writing the kubeconfig would change the existing file
+func (d *KubeconfigDiff) HasChanges() bool {
+	return len(d.Entries) > 0 || d.CurrentContext != nil
+}
+
+// String renders the diff as readable text, one line per entry followed by its field changes
+func (d *KubeconfigDiff) String() string {
+	var b strings.Builder
+
+	if !d.HasChanges() {
+		fmt.Fprintf(&b, "%s: no changes\n", d.OutputFile)
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "%s:\n", d.OutputFile)
+
+	symbols := map[DiffAction]string{DiffAdded: "+", DiffRemoved: "-", DiffChanged: "~"}
+	for _, entry := range d.Entries {
+		fmt.Fprintf(&b, "%s %s %s\n", symbols[entry.Action], entry.Kind, entry.Name)
+		if entry.OtherChanges {
+			fmt.Fprintf(&b, "    other settings changed\n")
+		}
+		for _, change := range entry.Changes {
+			switch {
+			case entry.Action == DiffAdded:
+				fmt.Fprintf(&b, "    %s: %s\n", change.Field, change.New)
+			case entry.Action == DiffRemoved:
+				fmt.Fprintf(&b, "    %s: %s\n", change.Field, change.Old)
+			default:
+				fmt.Fprintf(&b, "    %s: %s -> %s\n", change.Field, orNone(change.Old), orNone(change.New))
+			}
+		}
+	}
+
+	if d.CurrentContext != nil {
+		fmt.Fprintf(&b, "~ current-context: %s -> %s\n", orNone(d.CurrentContext.Old), orNone(d.CurrentContext.New))
+	}
+
+	return b.String()
+}
+
+// orNone shows an unset value in a diff
+func orNone(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+	return value
+}
@@ -0,0 +1,199 @@
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// The Kubeconfig types inline Extra in JSON as yaml.v3 does with `yaml:",inline"`, so unknown keys
+// survive a round trip through encoding/json too
+
+func (k Kubeconfig) MarshalJSON() ([]byte, error) {
+	type plain Kubeconfig
+	return marshalInline(plain(k), k.Extra)
+}
+
+func (k *Kubeconfig) UnmarshalJSON(data []byte) error {
+	type plain Kubeconfig
+	return unmarshalInline(data, (*plain)(k), &k.Extra)
+}
+
+func (c KubeconfigClusterDetails) MarshalJSON() ([]byte, error) {
+	type plain KubeconfigClusterDetails
+	return marshalInline(plain(c), c.Extra)
+}
+
+func (c *KubeconfigClusterDetails) UnmarshalJSON(data []byte) error {
+	type plain KubeconfigClusterDetails
+	return unmarshalInline(data, (*plain)(c), &c.Extra)
+}
+
+func (u KubeconfigUserDetails) MarshalJSON() ([]byte, error) {
+	type plain KubeconfigUserDetails
+	return marshalInline(plain(u), u.Extra)
+}
+
+func (u *KubeconfigUserDetails) UnmarshalJSON(data []byte) error {
+	type plain KubeconfigUserDetails
+	return unmarshalInline(data, (*plain)(u), &u.Extra)
+}
+
+func (e KubeconfigExecConfig) MarshalJSON() ([]byte, error) {
+	type plain KubeconfigExecConfig
+	return marshalInline(plain(e), e.Extra)
+}
+
+func (e *KubeconfigExecConfig) UnmarshalJSON(data []byte) error {
+	type plain KubeconfigExecConfig
+	return unmarshalInline(data, (*plain)(e), &e.Extra)
+}
+
+func (c KubeconfigContextDetails) MarshalJSON() ([]byte, error) {
+	type plain KubeconfigContextDetails
+	return marshalInline(plain(c), c.Extra)
+}
+
+func (c *KubeconfigContextDetails) UnmarshalJSON(data []byte) error {
+	type plain KubeconfigContextDetails
+	return unmarshalInline(data, (*plain)(c), &c.Extra)
+}
+
+func (c KubeconfigCluster) MarshalJSON() ([]byte, error) {
+	type plain KubeconfigCluster
+	return marshalInline(plain(c), c.Extra)
+}
+
+func (c *KubeconfigCluster) UnmarshalJSON(data []byte) error {
+	type plain KubeconfigCluster
+	return unmarshalInline(data, (*plain)(c), &c.Extra)
+}
+
+func (a KubeconfigAuthProvider) MarshalJSON() ([]byte, error) {
+	type plain KubeconfigAuthProvider
+	return marshalInline(plain(a), a.Extra)
+}
+
+func (a *KubeconfigAuthProvider) UnmarshalJSON(data []byte) error {
+	type plain KubeconfigAuthProvider
+	return unmarshalInline(data, (*plain)(a), &a.Extra)
+}
+
+func (e KubeconfigExecEnvVar) MarshalJSON() ([]byte, error) {
+	type plain KubeconfigExecEnvVar
+	return marshalInline(plain(e), e.Extra)
+}
+
+func (e *KubeconfigExecEnvVar) UnmarshalJSON(data []byte) error {
+	type plain KubeconfigExecEnvVar
+	return unmarshalInline(data, (*plain)(e), &e.Extra)
+}
+
+func (u KubeconfigUser) MarshalJSON() ([]byte, error) {
+	type plain KubeconfigUser
+	return marshalInline(plain(u), u.Extra)
+}
+
+func (u *KubeconfigUser) UnmarshalJSON(data []byte) error {
+	type plain KubeconfigUser
+	return unmarshalInline(data, (*plain)(u), &u.Extra)
+}
+
+func (c KubeconfigContext) MarshalJSON() ([]byte, error) {
+	type plain KubeconfigContext
+	return marshalInline(plain(c), c.Extra)
+}
+
+func (c *KubeconfigContext) UnmarshalJSON(data []byte) error {
+	type plain KubeconfigContext
+	return unmarshalInline(data, (*plain)(c), &c.Extra)
+}
+
+func (e KubeconfigExtension) MarshalJSON() ([]byte, error) {
+	type plain KubeconfigExtension
+	return marshalInline(plain(e), e.Extra)
+}
+
+func (e *KubeconfigExtension) UnmarshalJSON(data []byte) error {
+	type plain KubeconfigExtension
+	return unmarshalInline(data, (*plain)(e), &e.Extra)
+}
+
+func (p KubeconfigPreferences) MarshalJSON() ([]byte, error) {
+	type plain KubeconfigPreferences
+	return marshalInline(plain(p), p.Extra)
+}
+
+func (p *KubeconfigPreferences) UnmarshalJSON(data []byte) error {
+	type plain KubeconfigPreferences
+	return unmarshalInline(data, (*plain)(p), &p.Extra)
+}
+
+// marshalInline encodes v, a struct without JSON methods, with the keys of extra added at its top level
+// Keys of extra clashing with a field of v are dropped, as yaml.v3 does on decoding
+func marshalInline(v any, extra map[string]any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range extra {
+		if _, ok := fields[key]; ok {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		fields[key] = raw
+	}
+	return json.Marshal(fields)
+}
+
+// unmarshalInline decodes data into v, a pointer to a struct without JSON methods, collecting the keys
+// matching none of its fields into extra
+func unmarshalInline(data []byte, v any, extra *map[string]any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, name := range jsonFieldNames(reflect.TypeOf(v).Elem()) {
+		for key := range fields {
+			// encoding/json matches keys to fields case-insensitively
+			if strings.EqualFold(key, name) {
+				delete(fields, key)
+			}
+		}
+	}
+
+	*extra = nil
+	if len(fields) > 0 {
+		*extra = fields
+	}
+	return nil
+}
+
+// jsonFieldNames returns the JSON keys of the fields of struct type t
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -1,60 +1,365 @@
 package types
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
 
 type RMSCluster struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type RMSPagination struct {
+	First   string `json:"first,omitempty"`
+	Next    string `json:"next,omitempty"`
+	Limit   int    `json:"limit,omitempty"`
+	Total   int    `json:"total,omitempty"`
+	Partial bool   `json:"partial,omitempty"`
 }
 
 type RMSClusterResponse struct {
-	Data []RMSCluster `json:"data"`
+	Data       []RMSCluster   `json:"data"`
+	Pagination *RMSPagination `json:"pagination,omitempty"`
+}
+
+// RMSAPIError is the body Rancher returns when it rejects a request
+type RMSAPIError struct {
+	Type     string `json:"type"`
+	BaseType string `json:"baseType,omitempty"`
+	Status   string `json:"status"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
 }
 
 type KubeconfigResponse struct {
 	Config string `json:"config"`
 }
 
+// The Kubeconfig types model the complete kubeconfig v1 schema (k8s.io/client-go/tools/clientcmd/api/v1)
+// Keys not known to the schema are kept in Extra so they survive a merge
+
 type KubeconfigClusterDetails struct {
-	Server                   string `yaml:"server" json:"server"`
-	CertificateAuthorityData string `yaml:"certificate-authority-data" json:"certificate-authority-data"`
+	Server                   string                `yaml:"server" json:"server"`
+	TLSServerName            string                `yaml:"tls-server-name,omitempty" json:"tls-server-name,omitempty"`
+	InsecureSkipTLSVerify    bool                  `yaml:"insecure-skip-tls-verify,omitempty" json:"insecure-skip-tls-verify,omitempty"`
+	CertificateAuthority     string                `yaml:"certificate-authority,omitempty" json:"certificate-authority,omitempty"`
+	CertificateAuthorityData string                `yaml:"certificate-authority-data,omitempty" json:"certificate-authority-data,omitempty"`
+	ProxyURL                 string                `yaml:"proxy-url,omitempty" json:"proxy-url,omitempty"`
+	DisableCompression       bool                  `yaml:"disable-compression,omitempty" json:"disable-compression,omitempty"`
+	Extensions               []KubeconfigExtension `yaml:"extensions,omitempty" json:"extensions,omitempty"`
+	Extra                    map[string]any        `yaml:",inline" json:"-"`
 }
 
 type KubeconfigCluster struct {
 	Name    string                   `yaml:"name" json:"name"`
 	Cluster KubeconfigClusterDetails `yaml:"cluster" json:"cluster"`
+	Extra   map[string]any           `yaml:",inline" json:"-"`
+}
+
+type KubeconfigAuthProvider struct {
+	Name   string            `yaml:"name" json:"name"`
+	Config map[string]string `yaml:"config,omitempty" json:"config,omitempty"`
+	Extra  map[string]any    `yaml:",inline" json:"-"`
+}
+
+type KubeconfigExecEnvVar struct {
+	Name  string         `yaml:"name" json:"name"`
+	Value string         `yaml:"value" json:"value"`
+	Extra map[string]any `yaml:",inline" json:"-"`
+}
+
+type KubeconfigExecConfig struct {
+	Command            string                 `yaml:"command" json:"command"`
+	Args               []string               `yaml:"args,omitempty" json:"args,omitempty"`
+	Env                []KubeconfigExecEnvVar `yaml:"env,omitempty" json:"env,omitempty"`
+	APIVersion         string                 `yaml:"apiVersion,omitempty" json:"apiVersion,omitempty"`
+	InstallHint        string                 `yaml:"installHint,omitempty" json:"installHint,omitempty"`
+	ProvideClusterInfo bool                   `yaml:"provideClusterInfo,omitempty" json:"provideClusterInfo,omitempty"`
+	InteractiveMode    string                 `yaml:"interactiveMode,omitempty" json:"interactiveMode,omitempty"`
+	Extra              map[string]any         `yaml:",inline" json:"-"`
+}
+
+type KubeconfigUserDetails struct {
+	ClientCertificate     string                  `yaml:"client-certificate,omitempty" json:"client-certificate,omitempty"`
+	ClientCertificateData string                  `yaml:"client-certificate-data,omitempty" json:"client-certificate-data,omitempty"`
+	ClientKey             string                  `yaml:"client-key,omitempty" json:"client-key,omitempty"`
+	ClientKeyData         string                  `yaml:"client-key-data,omitempty" json:"client-key-data,omitempty"`
+	Token                 string                  `yaml:"token,omitempty" json:"token,omitempty"`
+	TokenFile             string                  `yaml:"tokenFile,omitempty" json:"tokenFile,omitempty"`
+	Impersonate           string                  `yaml:"as,omitempty" json:"as,omitempty"`
+	ImpersonateUID        string                  `yaml:"as-uid,omitempty" json:"as-uid,omitempty"`
+	ImpersonateGroups     []string                `yaml:"as-groups,omitempty" json:"as-groups,omitempty"`
+	ImpersonateUserExtra  map[string][]string     `yaml:"as-user-extra,omitempty" json:"as-user-extra,omitempty"`
+	Username              string                  `yaml:"username,omitempty" json:"username,omitempty"`
+	Password              string                  `yaml:"password,omitempty" json:"password,omitempty"`
+	AuthProvider          *KubeconfigAuthProvider `yaml:"auth-provider,omitempty" json:"auth-provider,omitempty"`
+	Exec                  *KubeconfigExecConfig   `yaml:"exec,omitempty" json:"exec,omitempty"`
+	Extensions            []KubeconfigExtension   `yaml:"extensions,omitempty" json:"extensions,omitempty"`
+	Extra                 map[string]any          `yaml:",inline" json:"-"`
 }
 
 type KubeconfigUser struct {
-	Name string `yaml:"name" json:"name"`
-	User struct {
-		Token string `yaml:"token" json:"token"`
-	} `yaml:"user" json:"user"`
+	Name  string                `yaml:"name" json:"name"`
+	User  KubeconfigUserDetails `yaml:"user" json:"user"`
+	Extra map[string]any        `yaml:",inline" json:"-"`
+}
+
+type KubeconfigContextDetails struct {
+	User       string                `yaml:"user" json:"user"`
+	Cluster    string                `yaml:"cluster" json:"cluster"`
+	Namespace  string                `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Extensions []KubeconfigExtension `yaml:"extensions,omitempty" json:"extensions,omitempty"`
+	Extra      map[string]any        `yaml:",inline" json:"-"`
 }
 
 type KubeconfigContext struct {
-	Name    string `yaml:"name" json:"name"`
-	Context struct {
-		User    string `yaml:"user" json:"user"`
-		Cluster string `yaml:"cluster" json:"cluster"`
-	} `yaml:"context" json:"context"`
+	Name    string                   `yaml:"name" json:"name"`
+	Context KubeconfigContextDetails `yaml:"context" json:"context"`
+	Extra   map[string]any           `yaml:",inline" json:"-"`
+}
+
+// KubeconfigExtension holds an arbitrary named extension object
+type KubeconfigExtension struct {
+	Name      string         `yaml:"name" json:"name"`
+	Extension any            `yaml:"extension" json:"extension"`
+	Extra     map[string]any `yaml:",inline" json:"-"`
+}
+
+// ManagedMarker is the extension value marking entries generated from an RMS cluster
+type ManagedMarker struct {
+	RMSUrl    string `yaml:"rmsUrl" json:"rmsUrl"`
+	ClusterID string `yaml:"clusterID" json:"clusterID"`
+}
+
+type KubeconfigPreferences struct {
+	Colors     bool                  `yaml:"colors,omitempty" json:"colors,omitempty"`
+	Extensions []KubeconfigExtension `yaml:"extensions,omitempty" json:"extensions,omitempty"`
+	Extra      map[string]any        `yaml:",inline" json:"-"`
 }
 
 type Kubeconfig struct {
-	APIVersion string              `yaml:"apiVersion" json:"apiVersion"`
-	Kind       string              `yaml:"kind" json:"kind"`
-	Clusters   []KubeconfigCluster `yaml:"clusters" json:"clusters"`
-	Users      []KubeconfigUser    `yaml:"users" json:"users"`
-	Contexts   []KubeconfigContext `yaml:"contexts" json:"contexts"`
+	APIVersion     string                `yaml:"apiVersion" json:"apiVersion"`
+	Kind           string                `yaml:"kind" json:"kind"`
+	Preferences    KubeconfigPreferences `yaml:"preferences,omitempty" json:"preferences,omitempty"`
+	Clusters       []KubeconfigCluster   `yaml:"clusters" json:"clusters"`
+	Users          []KubeconfigUser      `yaml:"users" json:"users"`
+	Contexts       []KubeconfigContext   `yaml:"contexts" json:"contexts"`
+	CurrentContext string                `yaml:"current-context,omitempty" json:"current-context,omitempty"`
+	Extensions     []KubeconfigExtension `yaml:"extensions,omitempty" json:"extensions,omitempty"`
+	Extra          map[string]any        `yaml:",inline" json:"-"`
 }
 
-const ErrRequestCode = 1000
+// PrunedEntry identifies a kubeconfig entry removed because its RMS cluster no longer exists
+type PrunedEntry struct {
+	Kind      string // cluster, user or context
+	Name      string
+	ClusterID string
+}
+
+// Backup identifies a timestamped copy of a replaced kubeconfig
+type Backup struct {
+	Path string
+	Time time.Time
+}
+
+// ClusterStatus describes whether a cluster made it into the combined kubeconfig
+type ClusterStatus string
+
+const (
+	ClusterIncluded ClusterStatus = "included"
+	ClusterFailed   ClusterStatus = "failed"
+	ClusterSkipped  ClusterStatus = "skipped"
+)
+
+// CurrentContextMode selects how current-context of the written kubeconfig is chosen
+type CurrentContextMode string
+
+const (
+	CurrentContextDefault CurrentContextMode = ""      // taken from the first generated kubeconfig setting one in merge order, or kept when merging
+	CurrentContextNamed   CurrentContextMode = "named" // the context of a named cluster
+	CurrentContextFirst   CurrentContextMode = "first" // the first context in output order (SortKey)
+	CurrentContextKeep    CurrentContextMode = "keep"  // the current-context of the existing output file
+)
+
+// SortKey selects the order of entries in the written kubeconfig
+type SortKey string
+
+const (
+	SortByContext   SortKey = ""           // contexts by name
+	SortByCluster   SortKey = "cluster"    // contexts by the name of their cluster, then by name
+	SortByClusterID SortKey = "cluster-id" // contexts by RMS cluster ID, then by name
+	SortNone        SortKey = "none"       // the order clusters are listed by RMS
+)
+
+// CollisionStrategy selects how entries of different clusters sharing a name are resolved
+type CollisionStrategy string
+
+const (
+	CollisionFail     CollisionStrategy = ""          // fail the run, nothing is written
+	CollisionSuffix   CollisionStrategy = "suffix"    // rename every colliding entry to <name>-<cluster ID>
+	CollisionLastWins CollisionStrategy = "last-wins" // keep the entry of the cluster merged last
+)
+
+// Collision describes a cluster, user or context name used by more than one RMS cluster
+type Collision struct {
+	Kind       string // cluster, user or context
+	Name       string
+	ClusterIDs []string // RMS clusters whose entries share Name, in merge order
+	Resolution CollisionStrategy
+	Renamed    map[string]string // CollisionSuffix: new name by cluster ID
+	Winner     string            // CollisionLastWins: cluster ID whose entry was kept
+	Dropped    []string          // CollisionLastWins: contexts removed along with a dropped cluster or user, and users left without a context
+}
+
+// NameTemplateData is the data a name template is executed with, once per cluster, user and context entry
+type NameTemplateData struct {
+	Kind        string // cluster, user or context
+	Name        string // name of the entry as returned by RMS generateKubeconfig
+	ClusterID   string
+	ClusterName string
+	RMSHost     string // host of the RMS URL, without port
+	Labels      map[string]string
+	Annotations map[string]string
+	Env         string // value of the env label
+}
+
+// ClusterResult records the outcome of generating the kubeconfig of a single cluster
+type ClusterResult struct {
+	ClusterID string
+	Status    ClusterStatus
+	Contexts  []string
+	Duration  time.Duration
+	Err       error
+}
+
+// GenerateReport summarizes a combined kubeconfig generation
+type GenerateReport struct {
+	OutputFile string
+	Clusters   []ClusterResult
+	Diff       *KubeconfigDiff // set for a dry run
+	Collisions []Collision
+}
+
+const (
+	ErrRequestCode           = 1000 // request could not be built
+	ErrUnauthorizedCode      = 1001 // RMS rejected the API token (401)
+	ErrForbiddenCode         = 1002 // API token lacks access (403)
+	ErrNotFoundCode          = 1003 // cluster or endpoint does not exist (404)
+	ErrTransportCode         = 1004 // no response from RMS (network error, timeout, cancellation)
+	ErrDecodeCode            = 1005 // RMS response body could not be decoded
+	ErrInvalidKubeconfigCode = 1006 // generated kubeconfig is not valid YAML
+	ErrWriteCode             = 1007 // combined kubeconfig could not be written
+	ErrStatusCode            = 1008 // any other unexpected response status
+	ErrLockedCode            = 1009 // output file is locked by another run
+	ErrContextNotFoundCode   = 1010 // requested current-context is not among the fetched clusters
+	ErrCollisionCode         = 1011 // entries of different clusters share a name
+	ErrNameTemplateCode      = 1012 // name template could not be rendered for a cluster
+)
+
+// Sentinel errors matched by RequestError codes through errors.Is
+var (
+	ErrRequest           = errors.New("invalid request")
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrForbidden         = errors.New("forbidden")
+	ErrNotFound          = errors.New("not found")
+	ErrTransport         = errors.New("transport failure")
+	ErrDecode            = errors.New("decode failure")
+	ErrInvalidKubeconfig = errors.New("invalid kubeconfig")
+	ErrWrite             = errors.New("write failure")
+	ErrStatus            = errors.New("unexpected response status")
+	ErrLocked            = errors.New("output file locked")
+	ErrContextNotFound   = errors.New("context not found")
+	ErrCollision         = errors.New("name collision")
+	ErrNameTemplate      = errors.New("name template failure")
+)
+
+var codeSentinels = map[int]error{
+	ErrRequestCode:           ErrRequest,
+	ErrUnauthorizedCode:      ErrUnauthorized,
+	ErrForbiddenCode:         ErrForbidden,
+	ErrNotFoundCode:          ErrNotFound,
+	ErrTransportCode:         ErrTransport,
+	ErrDecodeCode:            ErrDecode,
+	ErrInvalidKubeconfigCode: ErrInvalidKubeconfig,
+	ErrWriteCode:             ErrWrite,
+	ErrStatusCode:            ErrStatus,
+	ErrLockedCode:            ErrLocked,
+	ErrContextNotFoundCode:   ErrContextNotFound,
+	ErrCollisionCode:         ErrCollision,
+	ErrNameTemplateCode:      ErrNameTemplate,
+}
+
+// StatusErrorCode maps an unexpected HTTP status to its error code
+func StatusErrorCode(status int) int {
+	switch status {
+	case http.StatusUnauthorized:
+		return ErrUnauthorizedCode
+	case http.StatusForbidden:
+		return ErrForbiddenCode
+	case http.StatusNotFound:
+		return ErrNotFoundCode
+	}
+	return ErrStatusCode
+}
 
 type RequestError struct {
-	Code    int
-	Message string
+	Code       int
+	Message    string
+	Attempts   int
+	ClusterID  string
+	StatusCode int
+	RMSCode    string // error code reported by RMS, e.g. "Unauthorized"
+	RMSMessage string // error message reported by RMS, or a snippet of a non-JSON body
+	Err        error
 }
 
 func (e *RequestError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("code: %d, message: %s, attempts: %d", e.Code, e.Message, e.Attempts)
+	}
 	return fmt.Sprintf("code: %d, message: %s", e.Code, e.Message)
 }
+
+// Unwrap returns the underlying cause, if any
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel error for the error code
+func (e *RequestError) Is(target error) bool {
+	sentinel, ok := codeSentinels[e.Code]
+	return ok && sentinel == target
+}
+
+// GenerateError aggregates the per-cluster failures of a run that continued on error
+type GenerateError struct {
+	Failures []*RequestError
+	Total    int
+}
+
+func (e *GenerateError) Error() string {
+	details := make([]string, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		status := "no response"
+		if failure.StatusCode != 0 {
+			status = fmt.Sprintf("status %d", failure.StatusCode)
+		}
+		details = append(details, fmt.Sprintf("%s (%s): %s", failure.ClusterID, status, failure.Message))
+	}
+	return fmt.Sprintf("failed to generate kubeconfig for %d of %d clusters: %s", len(e.Failures), e.Total, strings.Join(details, "; "))
+}
+
+// Unwrap exposes the individual failures to errors.Is and errors.As
+func (e *GenerateError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, failure := range e.Failures {
+		errs[i] = failure
+	}
+	return errs
+}
@@ -0,0 +1,49 @@
+package rmskubeconfig
+
+import "github.com/michaeljsaenz/rmskubeconfig/internal/types"
+
+// The kubeconfig model follows the kubeconfig v1 schema, values carry yaml and json tags
+// so they can be serialized with gopkg.in/yaml.v3 or encoding/json, keys unknown to the schema
+// are kept in Extra and written back inline by both
+
+// Kubeconfig is a complete kubeconfig file
+type Kubeconfig = types.Kubeconfig
+
+// KubeconfigCluster is a named cluster entry
+type KubeconfigCluster = types.KubeconfigCluster
+
+// KubeconfigClusterDetails holds the connection settings of a cluster
+type KubeconfigClusterDetails = types.KubeconfigClusterDetails
+
+// KubeconfigUser is a named user entry
+type KubeconfigUser = types.KubeconfigUser
+
+// KubeconfigUserDetails holds the credentials of a user
+type KubeconfigUserDetails = types.KubeconfigUserDetails
+
+// KubeconfigAuthProvider configures an auth provider plugin
+type KubeconfigAuthProvider = types.KubeconfigAuthProvider
+
+// KubeconfigExecConfig configures an exec credential plugin
+type KubeconfigExecConfig = types.KubeconfigExecConfig
+
+// KubeconfigExecEnvVar is an environment variable passed to an exec credential plugin
+type KubeconfigExecEnvVar = types.KubeconfigExecEnvVar
+
+// KubeconfigContext is a named context entry
+type KubeconfigContext = types.KubeconfigContext
+
+// KubeconfigContextDetails ties a cluster, a user and a namespace together
+type KubeconfigContextDetails = types.KubeconfigContextDetails
+
+// KubeconfigExtension holds an arbitrary named extension object
+type KubeconfigExtension = types.KubeconfigExtension
+
+// KubeconfigPreferences holds kubectl preferences
+type KubeconfigPreferences = types.KubeconfigPreferences
+
+// ManagedMarker is the extension value marking entries generated from an RMS cluster
+type ManagedMarker = types.ManagedMarker
+
+// RMSCluster is a cluster listed by RMS, with the labels and annotations used by filters and name templates
+type RMSCluster = types.RMSCluster
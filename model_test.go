@@ -0,0 +1,104 @@
+package rmskubeconfig
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// unknownKeysKubeconfig has a key unknown to the schema at every level of the kubeconfig model
+const unknownKeysKubeconfig = `
+apiVersion: v1
+kind: Config
+preferences:
+  colors: true
+  x-preferences: preferences-extra
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.test
+    x-cluster: cluster-extra
+  x-named-cluster: named-cluster-extra
+users:
+- name: dev
+  user:
+    exec:
+      command: kubelogin
+      env:
+      - name: HOME
+        value: /home/dev
+        x-env: env-extra
+      x-exec: exec-extra
+    auth-provider:
+      name: oidc
+      x-auth-provider: auth-provider-extra
+    x-user: user-extra
+  x-named-user: named-user-extra
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev
+    extensions:
+    - name: team
+      extension: payments
+      x-extension: extension-extra
+    x-context: context-extra
+  x-named-context: named-context-extra
+x-top:
+  nested: true
+`
+
+func TestKubeconfig_YAMLKeepsUnknownKeys(t *testing.T) {
+	var kubeconfig Kubeconfig
+	if err := yaml.Unmarshal([]byte(unknownKeysKubeconfig), &kubeconfig); err != nil {
+		t.Fatalf("failed to unmarshal yaml: %v", err)
+	}
+	data, err := yaml.Marshal(kubeconfig)
+	if err != nil {
+		t.Fatalf("failed to marshal yaml: %v", err)
+	}
+
+	var input, output map[string]any
+	if err := yaml.Unmarshal([]byte(unknownKeysKubeconfig), &input); err != nil {
+		t.Fatalf("failed to unmarshal yaml: %v", err)
+	}
+	if err := yaml.Unmarshal(data, &output); err != nil {
+		t.Fatalf("failed to unmarshal yaml: %v", err)
+	}
+	if !reflect.DeepEqual(output, input) {
+		t.Errorf("expected the yaml round trip to keep every key, got:\n%s", data)
+	}
+}
+
+func TestKubeconfig_JSONKeepsUnknownKeys(t *testing.T) {
+	var fromYAML Kubeconfig
+	if err := yaml.Unmarshal([]byte(unknownKeysKubeconfig), &fromYAML); err != nil {
+		t.Fatalf("failed to unmarshal yaml: %v", err)
+	}
+
+	data, err := json.Marshal(fromYAML)
+	if err != nil {
+		t.Fatalf("failed to marshal json: %v", err)
+	}
+	var keys map[string]any
+	if err := json.Unmarshal(data, &keys); err != nil {
+		t.Fatalf("failed to unmarshal json: %v", err)
+	}
+	if _, ok := keys["x-top"]; !ok {
+		t.Errorf("expected unknown key x-top to be inlined, got %s", data)
+	}
+	if _, ok := keys["Extra"]; ok {
+		t.Errorf("expected no Extra key, got %s", data)
+	}
+
+	var fromJSON Kubeconfig
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatalf("failed to unmarshal json: %v", err)
+	}
+	if !reflect.DeepEqual(fromJSON, fromYAML) {
+		t.Errorf("expected the json round trip to keep the kubeconfig, got:\n%+v\nwant:\n%+v", fromJSON, fromYAML)
+	}
+}
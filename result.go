@@ -0,0 +1,105 @@
+package rmskubeconfig
+
+import (
+	"time"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+// ClusterStatus describes whether a cluster made it into the combined kubeconfig
+type ClusterStatus = types.ClusterStatus
+
+const (
+	ClusterIncluded = types.ClusterIncluded
+	ClusterFailed   = types.ClusterFailed
+	ClusterSkipped  = types.ClusterSkipped
+)
+
+// ClusterResult describes what a run did with a single cluster
+type ClusterResult struct {
+	ID       string
+	Name     string
+	Status   ClusterStatus
+	Contexts []string
+	Duration time.Duration
+	Err      error
+}
+
+// RunResult describes the outcome of a run
+// For a dry run nothing is written, included clusters are those that would be written and Diff holds the changes
+// Collisions lists the names shared by several clusters and how they were resolved
+type RunResult struct {
+	OutputFile string
+	Clusters   []ClusterResult
+	Duration   time.Duration
+	Diff       *KubeconfigDiff
+	Collisions []Collision
+}
+
+// newRunResult builds a RunResult from the resolved clusters and the generation report
+// Clusters removed by the cluster filter (filteredOut) follow the generated ones as skipped
+func newRunResult(clusters, filteredOut []types.RMSCluster, report *types.GenerateReport, duration time.Duration) *RunResult {
+	result := &RunResult{Duration: duration}
+	if report == nil {
+		return result
+	}
+
+	names := make(map[string]string, len(clusters))
+	for _, cluster := range clusters {
+		names[cluster.ID] = cluster.Name
+	}
+
+	result.OutputFile = report.OutputFile
+	result.Diff = report.Diff
+	result.Collisions = report.Collisions
+	for _, cluster := range report.Clusters {
+		result.Clusters = append(result.Clusters, ClusterResult{
+			ID:       cluster.ClusterID,
+			Name:     names[cluster.ClusterID],
+			Status:   cluster.Status,
+			Contexts: cluster.Contexts,
+			Duration: cluster.Duration,
+			Err:      cluster.Err,
+		})
+	}
+	for _, cluster := range filteredOut {
+		result.Clusters = append(result.Clusters, ClusterResult{ID: cluster.ID, Name: cluster.Name, Status: ClusterSkipped})
+	}
+
+	return result
+}
+
+// Included returns the clusters written to the output file
+func (r *RunResult) Included() []ClusterResult {
+	return r.withStatus(ClusterIncluded)
+}
+
+// Failed returns the clusters whose kubeconfig could not be generated
+func (r *RunResult) Failed() []ClusterResult {
+	return r.withStatus(ClusterFailed)
+}
+
+// Skipped returns the clusters left out of the output without failing themselves, including those
+// removed by the cluster filter
+func (r *RunResult) Skipped() []ClusterResult {
+	return r.withStatus(ClusterSkipped)
+}
+
+// Contexts returns the context names written to the output file
+func (r *RunResult) Contexts() []string {
+	var contexts []string
+	for _, cluster := range r.Included() {
+		contexts = append(contexts, cluster.Contexts...)
+	}
+	return contexts
+}
+
+func (r *RunResult) withStatus(status ClusterStatus) []ClusterResult {
+	var clusters []ClusterResult
+	for _, cluster := range r.Clusters {
+		if cluster.Status == status {
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters
+}
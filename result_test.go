@@ -0,0 +1,126 @@
+package rmskubeconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/michaeljsaenz/rmskubeconfig/internal/kubeconfig"
+	"github.com/michaeljsaenz/rmskubeconfig/internal/types"
+)
+
+func TestRunWithResult_ContinueOnError(t *testing.T) {
+	// mock response data
+	mockClusterResponse := types.RMSClusterResponse{Data: []types.RMSCluster{
+		{ID: "c1", Name: "Cluster-1"},
+		{ID: "c2", Name: "Cluster-2"},
+		{ID: "c3", Name: "Cluster-3"},
+	}}
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if action := r.URL.Query().Get("action"); action == kubeconfig.GenerateKubeconfigUrlAction {
+			clusterID := strings.TrimPrefix(r.URL.Path, kubeconfig.ClusterListPath)
+			if clusterID == "c2" {
+				http.Error(w, "cluster unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			config := fmt.Sprintf(`
+clusters:
+- name: %[1]s
+  cluster:
+    server: https://%[1]s.test
+users:
+- name: %[1]s
+  user:
+    token: token
+contexts:
+- name: ctx-%[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s`, clusterID)
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(types.KubeconfigResponse{Config: config})
+		} else if r.URL.Path == kubeconfig.ClusterListPath {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(mockClusterResponse)
+		}
+	}))
+	defer mockServer.Close()
+
+	c := &Config{
+		rmsUrl:          mockServer.URL,
+		apiToken:        "token-test:test",
+		outputPath:      t.TempDir(),
+		continueOnError: true,
+	}
+
+	result, err := c.RunWithResult(context.Background())
+	if err == nil {
+		t.Fatalf("expected error for failed cluster, but got nil")
+	}
+	if result == nil {
+		t.Fatalf("expected a result alongside the error")
+	}
+
+	if expected := filepath.Join(c.outputPath, "config"); result.OutputFile != expected {
+		t.Errorf("expected output file %q, got %q", expected, result.OutputFile)
+	}
+
+	if len(result.Clusters) != 3 {
+		t.Fatalf("expected 3 cluster results, got %d", len(result.Clusters))
+	}
+	if result.Clusters[0].Name != "Cluster-1" {
+		t.Errorf("expected cluster name to be resolved, got %q", result.Clusters[0].Name)
+	}
+
+	if failed := result.Failed(); len(failed) != 1 || failed[0].ID != "c2" || failed[0].Err == nil {
+		t.Errorf("expected c2 to be reported as failed, got %+v", failed)
+	}
+	if included := result.Included(); len(included) != 2 {
+		t.Errorf("expected 2 included clusters, got %+v", included)
+	}
+	if skipped := result.Skipped(); len(skipped) != 0 {
+		t.Errorf("expected no skipped clusters, got %+v", skipped)
+	}
+
+	expectedContexts := []string{"ctx-c1", "ctx-c3"}
+	if !reflect.DeepEqual(result.Contexts(), expectedContexts) {
+		t.Errorf("expected contexts %v, got %v", expectedContexts, result.Contexts())
+	}
+
+	if len(c.Clusters()) != 3 {
+		t.Errorf("expected 3 resolved clusters, got %d", len(c.Clusters()))
+	}
+}
+
+func TestRunWithResult_FailFastSkipsOutput(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "cluster not found", http.StatusNotFound)
+	}))
+	defer mockServer.Close()
+
+	c := &Config{
+		rmsUrl:     mockServer.URL,
+		apiToken:   "token-test:test",
+		outputPath: t.TempDir(),
+		clusterID:  "c1",
+	}
+
+	result, err := c.RunWithResult(context.Background())
+	if err == nil {
+		t.Fatalf("expected error, but got nil")
+	}
+
+	if result.OutputFile != "" {
+		t.Errorf("expected no output file, got %q", result.OutputFile)
+	}
+	if failed := result.Failed(); len(failed) != 1 || failed[0].ID != "c1" {
+		t.Errorf("expected c1 to be reported as failed, got %+v", failed)
+	}
+}